@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/daspawnw/k8s-node-label/pkg/asgcheck"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// checkASGTemplates compares the labels the controller sets on the nodes
+// matching selector with the node templates of their auto scaling groups.
+func checkASGTemplates(ctx context.Context, client kubernetes.Interface, source asgcheck.LabelSource, selector labels.Selector) (asgcheck.Result, error) {
+	checker, err := asgcheck.NewChecker(source)
+	if err != nil {
+		return asgcheck.Result{}, err
+	}
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return asgcheck.Result{}, err
+	}
+	return checker.Check(nodes.Items)
+}
+
+// runASGTemplateCheck prints the result of checkASGTemplates as JSON and
+// reports whether the labels are consistent. The caches of l are filled
+// first, the labels may depend on them.
+func runASGTemplateCheck(client kubernetes.Interface, source asgcheck.LabelSource, l lookups, selector labels.Selector) (bool, error) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	l.run(stopCh)
+
+	result, err := checkASGTemplates(context.Background(), client, source, selector)
+	if err != nil {
+		return false, err
+	}
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return false, fmt.Errorf("can't encode result: %v", err)
+	}
+	fmt.Println(string(out))
+	return result.Consistent(), nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import "fmt"
+
+const (
+	commandRun               = ""
+	commandExplain           = "explain"
+	commandCheckASGTemplates = "check-asg-templates"
+)
+
+// command is the subcommand given after the flags. "explain NODE" prints the
+// labeling decision of a node and "check-asg-templates" compares node labels
+// with auto scaling group node templates instead of running the controller.
+type command struct {
+	name string
+	// node is the node to explain.
+	node string
+}
+
+// parseCommand parses the arguments left after the flags.
+func parseCommand(args []string) (command, error) {
+	switch {
+	case len(args) == 0:
+		return command{name: commandRun}, nil
+	case args[0] == commandExplain && len(args) == 2:
+		return command{name: commandExplain, node: args[1]}, nil
+	case args[0] == commandCheckASGTemplates && len(args) == 1:
+		return command{name: commandCheckASGTemplates}, nil
+	}
+	return command{}, fmt.Errorf("usage: k8s-node-label [flags] [explain NODE | check-asg-templates]")
+}
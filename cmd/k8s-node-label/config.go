@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/client-go/tools/leaderelection"
+	"sigs.k8s.io/yaml"
+)
+
+// applyConfigFile sets all flags that weren't given on the command line from
+// a YAML file mapping flag names to values. Repeatable flags take a list.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// numbers are kept as written, float64 would turn 1000000 into 1e+06
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("can't parse config file %s: %v", path, err)
+	}
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("can't parse config file %s: %v", path, err)
+	}
+
+	setOnCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	for name, value := range values {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("config file %s contains unknown option %s", path, name)
+		}
+		if setOnCommandLine[name] {
+			continue
+		}
+
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			if err := fs.Set(name, fmt.Sprint(item)); err != nil {
+				return fmt.Errorf("config file %s has invalid value for %s: %v", path, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateTimings checks the timings the same way the leader election does,
+// but fails with a readable error instead of a panic.
+func validateTimings(resyncPeriod, leaseDuration, renewDeadline, retryPeriod time.Duration) error {
+	if resyncPeriod <= 0 {
+		return fmt.Errorf("resync-period must be greater than zero")
+	}
+	if retryPeriod <= 0 {
+		return fmt.Errorf("retry-period must be greater than zero")
+	}
+	if leaseDuration <= renewDeadline {
+		return fmt.Errorf("lease-duration (%s) must be greater than renew-deadline (%s)", leaseDuration, renewDeadline)
+	}
+	if renewDeadline <= time.Duration(leaderelection.JitterFactor*float64(retryPeriod)) {
+		return fmt.Errorf("renew-deadline (%s) must be greater than retry-period (%s) * %.1f", renewDeadline, retryPeriod, leaderelection.JitterFactor)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyConfigFile(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      string
+		args        []string
+		expected    map[string]string
+		expectedErr string
+	}{
+		{
+			name:     "large integer",
+			config:   "qps-limit: 1000000\n",
+			expected: map[string]string{"qps-limit": "1000000"},
+		},
+		{
+			name:     "float",
+			config:   "ratio: 0.5\n",
+			expected: map[string]string{"ratio": "0.5"},
+		},
+		{
+			name:     "boolean and duration",
+			config:   "dry-run: true\nresync-period: 30s\n",
+			expected: map[string]string{"dry-run": "true", "resync-period": "30s"},
+		},
+		{
+			name:     "repeatable flag",
+			config:   "label:\n- team=a\n- env=b\n",
+			expected: map[string]string{"label": "team=a,env=b"},
+		},
+		{
+			name:     "command line takes precedence",
+			config:   "qps-limit: 10\n",
+			args:     []string{"-qps-limit=20"},
+			expected: map[string]string{"qps-limit": "20"},
+		},
+		{
+			name:        "unknown option",
+			config:      "unknown: 1\n",
+			expectedErr: "contains unknown option unknown",
+		},
+		{
+			name:        "invalid value",
+			config:      "qps-limit: ten\n",
+			expectedErr: "has invalid value for qps-limit",
+		},
+		{
+			name:        "invalid yaml",
+			config:      "qps-limit: [\n",
+			expectedErr: "can't parse config file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.Int("qps-limit", 0, "")
+			fs.Float64("ratio", 0, "")
+			fs.Bool("dry-run", false, "")
+			fs.Duration("resync-period", time.Minute, "")
+			var labels stringSliceFlag
+			fs.Var(&labels, "label", "")
+			assert.NoError(t, fs.Parse(tc.args))
+
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(tc.config), 0o600))
+
+			err := applyConfigFile(fs, path)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			for name, value := range tc.expected {
+				assert.Equal(t, value, fs.Lookup(name).Value.String(), name)
+			}
+		})
+	}
+}
+
+func TestApplyConfigFileShouldFailOnMissingFile(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	assert.Error(t, applyConfigFile(fs, filepath.Join(t.TempDir(), "missing.yaml")))
+}
+
+func TestValidateTimings(t *testing.T) {
+	testCases := []struct {
+		name          string
+		resyncPeriod  time.Duration
+		leaseDuration time.Duration
+		renewDeadline time.Duration
+		retryPeriod   time.Duration
+		expectedErr   string
+	}{
+		{
+			name:          "defaults",
+			resyncPeriod:  time.Minute,
+			leaseDuration: 15 * time.Second,
+			renewDeadline: 10 * time.Second,
+			retryPeriod:   2 * time.Second,
+		},
+		{
+			name:          "zero resync period",
+			leaseDuration: 15 * time.Second,
+			renewDeadline: 10 * time.Second,
+			retryPeriod:   2 * time.Second,
+			expectedErr:   "resync-period must be greater than zero",
+		},
+		{
+			name:          "zero retry period",
+			resyncPeriod:  time.Minute,
+			leaseDuration: 15 * time.Second,
+			renewDeadline: 10 * time.Second,
+			expectedErr:   "retry-period must be greater than zero",
+		},
+		{
+			name:          "lease duration not above renew deadline",
+			resyncPeriod:  time.Minute,
+			leaseDuration: 10 * time.Second,
+			renewDeadline: 10 * time.Second,
+			retryPeriod:   2 * time.Second,
+			expectedErr:   "lease-duration (10s) must be greater than renew-deadline (10s)",
+		},
+		{
+			name:          "renew deadline too close to retry period",
+			resyncPeriod:  time.Minute,
+			leaseDuration: 15 * time.Second,
+			renewDeadline: 2 * time.Second,
+			retryPeriod:   2 * time.Second,
+			expectedErr:   "renew-deadline (2s) must be greater than retry-period (2s) * 1.2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateTimings(tc.resyncPeriod, tc.leaseDuration, tc.renewDeadline, tc.retryPeriod)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
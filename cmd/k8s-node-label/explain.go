@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/daspawnw/k8s-node-label/pkg/controller"
+)
+
+// explainNode prints the labeling decision of the node with the given name
+// as JSON. The caches of l are filled first, the decision may depend on them.
+func explainNode(nodeController controller.NodeController, l lookups, name string) error {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	l.run(stopCh)
+
+	e, err := nodeController.ExplainNode(context.Background(), name)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't encode explanation: %v", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import "strings"
+
+// stringSliceFlag collects the values of a flag that may be passed multiple times.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// configureLogging sets the format and level of the standard logger. The
+// verbose flag is kept as shortcut for the debug level.
+func configureLogging(format string, level string, verbose bool) error {
+	switch format {
+	case "text":
+		log.SetFormatter(&log.TextFormatter{})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %q, available values: (text, json)", format)
+	}
+
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		lvl = log.DebugLevel
+	}
+	log.SetLevel(lvl)
+	return nil
+}
+
+// identityHook adds the lease holder identity to every log entry, so logs of
+// several replicas can be told apart.
+type identityHook string
+
+func (h identityHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h identityHook) Fire(entry *log.Entry) error {
+	entry.Data["identity"] = string(h)
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/daspawnw/k8s-node-label/pkg/clusterapi"
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
+	"github.com/daspawnw/k8s-node-label/pkg/karpenter"
+)
+
+// lookups holds the informers of the control-plane detectors and node object
+// lookups the controller depends on. Unused ones are nil.
+type lookups struct {
+	mirrorPods *controlplane.MirrorPodDetector
+	machines   *clusterapi.MachineLookup
+	nodeClaims *karpenter.NodeClaimLookup
+}
+
+// onNodeChange calls reconcile with the name of a node once an object its
+// labels are derived from changed.
+func (l lookups) onNodeChange(reconcile func(nodeName string)) {
+	if l.mirrorPods != nil {
+		// relabel control-plane nodes once the kubelet created their mirror pod
+		l.mirrorPods.OnNodeChange(reconcile)
+	}
+	if l.machines != nil {
+		// relabel nodes once their Machine is found or moves to another pool
+		l.machines.OnNodeChange(reconcile)
+	}
+}
+
+// run starts the informers and waits for their caches.
+func (l lookups) run(stopCh <-chan struct{}) {
+	if l.mirrorPods != nil {
+		l.mirrorPods.Run(stopCh)
+	}
+	if l.nodeClaims != nil {
+		l.nodeClaims.Run(stopCh)
+	}
+	if l.machines != nil {
+		l.machines.Run(stopCh)
+	}
+}
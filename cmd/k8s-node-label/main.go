@@ -3,81 +3,197 @@ package main
 import (
 	"context"
 	"flag"
-	"github.com/google/uuid"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/tools/leaderelection"
-	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"net/http"
 	"os"
-	"time"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/daspawnw/k8s-node-label/pkg/common"
 	"github.com/daspawnw/k8s-node-label/pkg/controller"
 	"github.com/daspawnw/k8s-node-label/pkg/spotdiscovery"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
 )
 
 func main() {
 	const NamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 
-	kubeconfig := flag.String("kube-config", "", "Path to a kubeconfig file")
-	excludeNodeFromLoadbalancer := flag.Bool("exclude-loadbalancer", false, "Exclude Master nodes from loadbalancer label")
-	alphaFlags := flag.Bool("alpha-flags", false, "Include alpha labels")
-	excludeEviction := flag.Bool("exclude-evication", false, "Exclude Master node from eviction in case node is not-ready")
-	controlPlaneTaint := flag.String("control-plane-taint", "node-role.kubernetes.io/control-plane", "Override default taint for control-plane nodes")
-	controlPlaneLegacyLabel := flag.Bool("control-plane-legacy-label", false, "Enable legacy controlPlane label: \"node-role.kubernetes.io/master\"")
-	provider := flag.String("provider", "", "Select a provider for spot instance detection, available values: (aws)")
-	verbose := flag.Bool("v", false, "Print verbose log messages")
-	customRoleLabel := flag.String("custom-role-label", "", "Add additional \"node-role.kubernetes.io/VALUE\" labels equal to this label's value")
-	// leases
-	leaseId := flag.String("id", uuid.New().String(), "Lease holder identity name")
-	leaseLockName := flag.String("lease-lock-name", "k8s-node-label", "Lease lock resource name")
-	defaultNs := getCurrentNamespace(NamespaceFile)
-	leaseLockNamespace := flag.String("lease-lock-namespace", defaultNs, "Lease lock resource namespace")
-	karpenterEnabled := flag.Bool("karpenter-enabled", true, "Karpenter-managed nodes labeled with karpenter.sh/nodepool will be also labeled with node-role.kubernetes.io/karpenter")
-
+	o := newOptions(flag.CommandLine, getCurrentNamespace(NamespaceFile))
 	flag.Parse()
 
-	if *verbose {
-		log.SetLevel(log.DebugLevel)
-	} else {
-		log.SetLevel(log.InfoLevel)
+	if o.configFile != "" {
+		if err := applyConfigFile(flag.CommandLine, o.configFile); err != nil {
+			log.Fatalf("Failed to load config file: %v", err)
+			os.Exit(1)
+		}
 	}
 
-	if len(*leaseLockNamespace) == 0 {
-		log.Fatal("Flag lease-lock-namespace is not set and default value is not available")
+	cmd, err := parseCommand(flag.Args())
+	if err != nil {
+		log.Fatal(err)
 		os.Exit(1)
 	}
 
-	client, err := common.ClientSet(*kubeconfig)
+	if err := configureLogging(o.logFormat, o.logLevel, o.verbose); err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+		os.Exit(1)
+	}
+	log.AddHook(identityHook(o.leaseId))
+
+	if err := o.validate(cmd); err != nil {
+		log.Fatalf("Invalid flags: %v", err)
+		os.Exit(1)
+	}
+
+	client, err := common.ClientSet(o.kubeconfig)
 	if err != nil {
 		log.Fatalf("Failed to create Kubernetes client %v", err)
 		os.Exit(1)
 	}
 
-	spotProvider, err := spotdiscovery.SpotProviderFactory(*provider)
+	config, nodeLookups, err := o.controllerConfig(client)
+	if err != nil {
+		log.Fatalf("Invalid controller configuration: %v", err)
+		os.Exit(1)
+	}
+
+	spotProvider, err := spotdiscovery.SpotProviderFactory(o.provider)
 	if err != nil {
 		log.Fatalf("can't get spot provider client: %v", err)
 		os.Exit(1)
 	}
 
+	shutdownTracing := func(context.Context) error { return nil }
+	if o.tracingEndpoint != "" {
+		shutdownTracing, err = setupTracing(context.Background(), o.tracingEndpoint, o.tracingInsecure, o.leaseId)
+		if err != nil {
+			log.Fatalf("Failed to set up tracing: %v", err)
+			os.Exit(1)
+		}
+	}
+	// flush pending spans, the leader election exits the process directly
+	defer shutdownTracing(context.Background())
+
+	auditSink, closeAudit, err := o.auditSink(client)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+	defer closeAudit()
+	config.AuditSink = auditSink
+
+	nodeController := controller.NewNodeController(client, spotProvider, config)
+	nodeLookups.onNodeChange(nodeController.ReconcileNode)
+
+	switch cmd.name {
+	case commandExplain:
+		if err := explainNode(nodeController, nodeLookups, cmd.node); err != nil {
+			log.Fatalf("Failed to explain node %s: %v", cmd.node, err)
+			os.Exit(1)
+		}
+		return
+	case commandCheckASGTemplates:
+		consistent, err := runASGTemplateCheck(client, nodeController, nodeLookups, config.NodeSelector)
+		if err != nil {
+			log.Fatalf("Failed to check auto scaling group node templates: %v", err)
+			os.Exit(1)
+		}
+		if !consistent {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var reporter *controller.Reporter
+	if o.reportInterval > 0 {
+		reporter = controller.NewReporter(nodeController, prometheus.DefaultRegisterer)
+	}
+	if o.httpAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		mux.HandleFunc("/explain", nodeController.ServeExplain)
+		if reporter != nil {
+			mux.Handle("/report", reporter)
+		}
+		go serveHTTP(o.httpAddress, mux)
+	}
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	// lookups run on every replica, /explain is served by all of them
+	nodeLookups.run(signalCtx.Done())
+
+	run := func(stopCh <-chan struct{}) {
+		if reporter != nil {
+			go reporter.Run(o.reportInterval, stopCh)
+		}
+		nodeController.Run(stopCh)
+	}
+
+	if !o.leaderElect {
+		log.Warn("Leader election is disabled, make sure only a single replica is running")
+		run(signalCtx.Done())
+		return
+	}
+
+	if config.Shards != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		released := make(chan struct{})
+		go func() {
+			shardElection{
+				client:             client,
+				shards:             config.Shards,
+				maxShards:          o.maxShards,
+				leaseLockName:      o.leaseLockName,
+				leaseLockNamespace: o.leaseLockNamespace,
+				identity:           o.leaseId,
+				leaseDuration:      o.leaseDuration,
+				renewDeadline:      o.renewDeadline,
+				retryPeriod:        o.retryPeriod,
+				onAcquired:         nodeController.ProcessShard,
+			}.run(ctx)
+			close(released)
+		}()
+
+		log.WithField("shards", o.shardCount).Info("Starting workload sharded")
+		run(signalCtx.Done())
+		// release the shard leases once the controller stopped
+		cancel()
+		<-released
+		return
+	}
+
+	runLeaderElection(signalCtx, client, o, run, shutdownTracing)
+}
+
+// runLeaderElection runs the controller through run while this replica holds
+// the lease. It returns once signalCtx is done before the lease was acquired,
+// otherwise the process exits after the lease was released or lost.
+func runLeaderElection(signalCtx context.Context, client kubernetes.Interface, o *options, run func(stopCh <-chan struct{}), shutdownTracing func(context.Context) error) {
+	// ctx guards the lease, signalCtx the controller. The lease is only released
+	// after the controller has finished its in-flight updates.
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	leaseLock := &resourcelock.LeaseLock{
-		LeaseMeta: metav1.ObjectMeta{
-			Name:      *leaseLockName,
-			Namespace: *leaseLockNamespace,
-		},
-		Client: client.CoordinationV1(),
-		LockConfig: resourcelock.ResourceLockConfig{
-			Identity: *leaseId,
-		},
-	}
+	var leadingMu sync.Mutex
+	leading := false
+	go func() {
+		<-signalCtx.Done()
+		log.Info("Received termination signal, shutting down")
+		leadingMu.Lock()
+		defer leadingMu.Unlock()
+		if !leading {
+			cancel()
+		}
+	}()
 
 	// start the leader election code loop
 	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
-		Lock: leaseLock,
+		Lock: newLeaseLock(client, o.leaseLockName, o.leaseLockNamespace, o.leaseId),
 		// IMPORTANT: you MUST ensure that any code you have that
 		// is protected by the lease must terminate **before**
 		// you call cancel. Otherwise, you could have a background
@@ -85,26 +201,46 @@ func main() {
 		// get elected before your background loop finished, violating
 		// the stated goal of the lease.
 		ReleaseOnCancel: true,
-		LeaseDuration:   60 * time.Second,
-		RenewDeadline:   15 * time.Second,
-		RetryPeriod:     5 * time.Second,
+		LeaseDuration:   o.leaseDuration,
+		RenewDeadline:   o.renewDeadline,
+		RetryPeriod:     o.retryPeriod,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(ctx context.Context) {
-				log.Infof("Starting workload as lead: %s", *leaseId)
-				controller.NewNodeController(client, spotProvider, *excludeNodeFromLoadbalancer, *alphaFlags, *excludeEviction, *controlPlaneTaint, *controlPlaneLegacyLabel, *customRoleLabel, *karpenterEnabled).Controller.Run(wait.NeverStop)
+				leadingMu.Lock()
+				if signalCtx.Err() != nil {
+					leadingMu.Unlock()
+					return
+				}
+				leading = true
+				leadingMu.Unlock()
+				// release the lease once the controller stopped
+				defer cancel()
+
+				runCtx, runCancel := context.WithCancel(ctx)
+				defer runCancel()
+				stopOnSignal := context.AfterFunc(signalCtx, runCancel)
+				defer stopOnSignal()
+
+				log.Info("Starting workload as lead")
+				run(runCtx.Done())
 			},
 			OnStoppedLeading: func() {
 				// we can do cleanup here
-				log.Infof("leader lost: %s", *leaseId)
+				if signalCtx.Err() != nil {
+					log.Info("Lease released")
+				} else {
+					log.Info("Leader lost")
+				}
+				shutdownTracing(context.Background())
 				os.Exit(0)
 			},
 			OnNewLeader: func(identity string) {
 				// we're notified when new leader elected
-				if identity == *leaseId {
+				if identity == o.leaseId {
 					// I just got the lock
 					return
 				}
-				log.Infof("new leader elected: %s", identity)
+				log.WithField("leader", identity).Info("New leader elected")
 			},
 		},
 	})
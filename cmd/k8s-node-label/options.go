@@ -0,0 +1,371 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/daspawnw/k8s-node-label/pkg/audit"
+	"github.com/daspawnw/k8s-node-label/pkg/clusterapi"
+	"github.com/daspawnw/k8s-node-label/pkg/common"
+	"github.com/daspawnw/k8s-node-label/pkg/controller"
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
+	"github.com/daspawnw/k8s-node-label/pkg/karpenter"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+)
+
+// options holds the values of all command line flags.
+type options struct {
+	configFile                  string
+	kubeconfig                  string
+	excludeNodeFromLoadbalancer bool
+	alphaFlags                  bool
+	excludeEviction             bool
+	controlPlaneTaints          stringSliceFlag
+	controlPlaneLabelSelector   string
+	controlPlaneNamePattern     string
+	controlPlaneMirrorPods      bool
+	controlPlaneLegacyLabel     bool
+	provider                    string
+	verbose                     bool
+	logFormat                   string
+	logLevel                    string
+	customRoleLabels            stringSliceFlag
+	customRoleDelimiter         string
+	customRolePolicy            string
+	// leases
+	leaderElect            bool
+	leaseId                string
+	leaseLockName          string
+	leaseLockNamespace     string
+	leaseDuration          time.Duration
+	renewDeadline          time.Duration
+	retryPeriod            time.Duration
+	shardCount             int
+	maxShards              int
+	resyncPeriod           time.Duration
+	karpenterEnabled       bool
+	karpenterNodePoolRoles bool
+	karpenterCapacityType  bool
+	karpenterNodeClaims    bool
+	clusterAPI             bool
+	clusterAPIKubeconfig   string
+	clusterAPINamespace    string
+	clusterAPIClusterName  string
+	managedNodeGroups      string
+	roleLabelStyle         string
+	roleLabelPrefix        string
+	roleLabelKey           string
+	rolePrecedence         string
+	nodeSelector           string
+	metadataOnly           bool
+	httpAddress            string
+	reportInterval         time.Duration
+	auditFile              string
+	auditConfigMap         string
+	auditConfigMapSize     int
+	tracingEndpoint        string
+	tracingInsecure        bool
+	waitForTaints          stringSliceFlag
+	preLabel               bool
+	startupTaint           string
+	conditionLabelRules    stringSliceFlag
+	labelTemplateRules     stringSliceFlag
+}
+
+// newOptions registers all flags on fs. defaultNamespace is the default of
+// the lease-lock-namespace flag.
+func newOptions(fs *flag.FlagSet, defaultNamespace string) *options {
+	o := &options{}
+	fs.StringVar(&o.configFile, "config", "", "Path to a YAML file setting flags by name, flags given on the command line take precedence")
+	fs.StringVar(&o.kubeconfig, "kube-config", "", "Path to a kubeconfig file")
+	fs.BoolVar(&o.excludeNodeFromLoadbalancer, "exclude-loadbalancer", false, "Exclude Master nodes from loadbalancer label")
+	fs.BoolVar(&o.alphaFlags, "alpha-flags", false, "Include alpha labels")
+	fs.BoolVar(&o.excludeEviction, "exclude-evication", false, "Exclude Master node from eviction in case node is not-ready")
+	fs.Var(&o.controlPlaneTaints, "control-plane-taint", "Override default taint for control-plane nodes (default \"node-role.kubernetes.io/control-plane\", can be repeated)")
+	fs.StringVar(&o.controlPlaneLabelSelector, "control-plane-label-selector", "", "Detect control-plane nodes by a label selector, e.g. \"node-role.kubernetes.io/control-plane\"")
+	fs.StringVar(&o.controlPlaneNamePattern, "control-plane-name-pattern", "", "Detect control-plane nodes by a regular expression matching the node name")
+	fs.BoolVar(&o.controlPlaneMirrorPods, "control-plane-mirror-pods", false, "Detect control-plane nodes by kube-apiserver mirror pods in kube-system bound to the node")
+	fs.BoolVar(&o.controlPlaneLegacyLabel, "control-plane-legacy-label", false, "Enable legacy controlPlane label: \"node-role.kubernetes.io/master\"")
+	fs.StringVar(&o.provider, "provider", "", "Select a provider for spot instance detection, available values: (aws)")
+	fs.BoolVar(&o.verbose, "v", false, "Print verbose log messages, shortcut for -log-level=debug")
+	fs.StringVar(&o.logFormat, "log-format", "text", "Log format, available values: (text, json)")
+	fs.StringVar(&o.logLevel, "log-level", "info", "Log level, available values: (debug, info, warning, error)")
+	fs.Var(&o.customRoleLabels, "custom-role-label", "Add additional \"node-role.kubernetes.io/VALUE\" labels equal to this label's value, in the form LABEL[,trim-prefix=PREFIX][,map=FROM:TO;FROM:TO] (can be repeated)")
+	fs.StringVar(&o.customRoleDelimiter, "custom-role-delimiter", ",", "Split custom role label values at this delimiter into multiple roles, empty disables splitting")
+	fs.StringVar(&o.customRolePolicy, "custom-role-conflict-policy", string(controller.CustomRoleConflictAll), "Policy when multiple custom role labels disagree, available values: (all, first, skip)")
+	// leases
+	fs.BoolVar(&o.leaderElect, "leader-elect", true, "Guard the controller with a leader election lease, disable for local development or single-replica deployments")
+	fs.StringVar(&o.leaseId, "id", uuid.New().String(), "Lease holder identity name")
+	fs.StringVar(&o.leaseLockName, "lease-lock-name", "k8s-node-label", "Lease lock resource name")
+	fs.StringVar(&o.leaseLockNamespace, "lease-lock-namespace", defaultNamespace, "Lease lock resource namespace")
+	fs.DurationVar(&o.leaseDuration, "lease-duration", 60*time.Second, "Duration non-leader candidates wait before trying to acquire the lease")
+	fs.DurationVar(&o.renewDeadline, "renew-deadline", 15*time.Second, "Duration the leader retries renewing the lease before giving up leadership")
+	fs.DurationVar(&o.retryPeriod, "retry-period", 5*time.Second, "Duration between lease acquire and renew attempts")
+	fs.IntVar(&o.shardCount, "shards", 1, "Split nodes by name hash into this many shards, each guarded by its own lease \"<lease-lock-name>-<shard>\", so replicas share the work. 1 disables sharding")
+	fs.IntVar(&o.maxShards, "max-shards-per-replica", 0, "Maximum number of shards a replica takes over in sharded mode, 0 is unlimited")
+	fs.DurationVar(&o.resyncPeriod, "resync-period", controller.DefaultResyncPeriod, "Interval in which all nodes are reprocessed")
+	fs.BoolVar(&o.karpenterEnabled, "karpenter-enabled", true, "Karpenter-managed nodes labeled with karpenter.sh/nodepool will be also labeled with node-role.kubernetes.io/karpenter")
+	fs.BoolVar(&o.karpenterNodePoolRoles, "karpenter-nodepool-roles", false, "Label Karpenter-managed nodes with node-role.kubernetes.io/<nodepool> named after their karpenter.sh/nodepool")
+	fs.BoolVar(&o.karpenterCapacityType, "karpenter-capacity-type", false, "Detect spot instances of Karpenter-managed nodes by their karpenter.sh/capacity-type label instead of the spot provider")
+	fs.BoolVar(&o.karpenterNodeClaims, "karpenter-nodeclaims", false, "Take the Karpenter labels from the NodeClaim of nodes not carrying them yet")
+	fs.BoolVar(&o.clusterAPI, "cluster-api", false, "Watch Cluster API Machines to detect control-plane nodes and label nodes with node-role.kubernetes.io/<pool> named after their MachineDeployment or MachinePool")
+	fs.StringVar(&o.clusterAPIKubeconfig, "cluster-api-kube-config", "", "Path to a kubeconfig file of the management cluster holding the Machines, defaults to the cluster of the nodes")
+	fs.StringVar(&o.clusterAPINamespace, "cluster-api-namespace", "", "Namespace of the Machines, empty watches all namespaces")
+	fs.StringVar(&o.clusterAPIClusterName, "cluster-api-cluster-name", "", "Only use Machines labeled with this cluster.x-k8s.io/cluster-name")
+	fs.StringVar(&o.managedNodeGroups, "managed-node-groups", "", "Comma separated list of managed Kubernetes providers whose node group labels are turned into node-role.kubernetes.io/<node group> and spot labels, available values: (eks, gke, aks)")
+	fs.StringVar(&o.roleLabelStyle, "role-label-style", string(controller.RoleLabelStylePrefix), "How roles are written to nodes, available values: (prefix, value, both)")
+	fs.StringVar(&o.roleLabelPrefix, "role-label-prefix", controller.DefaultRoleLabelPrefix, "Prefix of role labels written in prefix style")
+	fs.StringVar(&o.roleLabelKey, "role-label-key", controller.DefaultRoleLabelKey, "Label key holding the primary role in value style")
+	fs.StringVar(&o.rolePrecedence, "role-precedence", "", "Comma separated list of exclusive roles from highest to lowest precedence, e.g. \"control-plane,worker\". A node only keeps the label of the first role it qualifies for, empty keeps all roles additive")
+	fs.StringVar(&o.nodeSelector, "node-selector", "", "Only manage nodes matching this label selector, e.g. \"node.kubernetes.io/instance-type!=metal\"")
+	fs.BoolVar(&o.metadataOnly, "metadata-only", false, "Watch node metadata only to reduce memory usage. Taints and provider IDs aren't available, so spot discovery and taint based control-plane detection can't be used")
+	fs.StringVar(&o.httpAddress, "http-address", "", "Address serving /metrics, /explain?node=NAME and /report, e.g. \":8080\", empty disables the HTTP server")
+	fs.DurationVar(&o.reportInterval, "report-interval", 0, "Interval of the reconciliation report summarizing the labels of all nodes, 0 disables the report")
+	fs.StringVar(&o.auditFile, "audit-file", "", "Append a JSON line for every node label change to this file")
+	fs.StringVar(&o.auditConfigMap, "audit-configmap", "", "Keep the latest node label changes as JSON lines in this ConfigMap in the lease-lock-namespace")
+	fs.IntVar(&o.auditConfigMapSize, "audit-configmap-size", 200, "Number of label changes kept in the audit ConfigMap, older changes are also dropped beyond 768 KiB")
+	fs.StringVar(&o.tracingEndpoint, "tracing-endpoint", "", "Export OpenTelemetry traces to this OTLP/HTTP collector, e.g. \"localhost:4318\", empty disables tracing")
+	fs.BoolVar(&o.tracingInsecure, "tracing-insecure", false, "Export traces over plain HTTP instead of HTTPS")
+	fs.Var(&o.waitForTaints, "wait-for-taint", "Treat nodes with this taint as not yet initialized and requeue them with backoff (default \"node.cloudprovider.kubernetes.io/uninitialized\", can be repeated)")
+	fs.BoolVar(&o.preLabel, "pre-label", false, "Apply labels that don't depend on the spot provider to nodes that aren't initialized yet")
+	fs.StringVar(&o.startupTaint, "startup-taint", "", "Remove this taint from initialized nodes once all labels are applied, e.g. \"k8s-node-label.io/not-labeled\", empty disables it")
+	fs.Var(&o.conditionLabelRules, "condition-label", "Set a label while node conditions are met and remove it otherwise, in the form KEY=VALUE:TYPE[=STATUS][,TYPE[=STATUS]], e.g. 'example.com/ingress-ready=true:Ready,NetworkUnavailable=False' (can be repeated)")
+	fs.Var(&o.labelTemplateRules, "label-template", "Add a label rendered from a Go template over the node object in the form KEY=VALUE, e.g. 'topology.example.com/rack={{ index .Labels \"rack\" | lower }}' (can be repeated)")
+	return o
+}
+
+// validate checks flags that can't be used together. Flags holding rules
+// are checked while building the controller config. The lease namespace is
+// only required if command runs the controller.
+func (o *options) validate(cmd command) error {
+	if cmd.name == commandCheckASGTemplates && o.provider != "aws" {
+		return fmt.Errorf("subcommand check-asg-templates requires provider aws")
+	}
+	if err := validateTimings(o.resyncPeriod, o.leaseDuration, o.renewDeadline, o.retryPeriod); err != nil {
+		return fmt.Errorf("invalid timings: %v", err)
+	}
+	if o.leaderElect && cmd.name == commandRun && len(o.leaseLockNamespace) == 0 {
+		return fmt.Errorf("flag lease-lock-namespace is not set and default value is not available")
+	}
+	if o.reportInterval < 0 {
+		return fmt.Errorf("flag report-interval must not be negative")
+	}
+	if o.auditConfigMap != "" && (len(o.leaseLockNamespace) == 0 || o.auditConfigMapSize < 1) {
+		return fmt.Errorf("flag audit-configmap requires lease-lock-namespace and an audit-configmap-size of at least 1")
+	}
+	if o.shardCount < 1 || o.maxShards < 0 {
+		return fmt.Errorf("flag shards must be at least 1 and max-shards-per-replica must not be negative")
+	}
+	if o.shardCount > 1 && !o.leaderElect {
+		return fmt.Errorf("flag shards can't be used without leader-elect")
+	}
+	if o.startupTaint != "" && slices.Contains(o.waitForTaints, o.startupTaint) {
+		// the node would never count as initialized, so the taint would never be removed
+		return fmt.Errorf("flag startup-taint can't be one of the wait-for-taint taints")
+	}
+	if o.metadataOnly {
+		if o.provider != "" {
+			return fmt.Errorf("flag provider can't be used together with metadata-only")
+		}
+		if len(o.conditionLabelRules) > 0 {
+			return fmt.Errorf("flag condition-label can't be used together with metadata-only")
+		}
+		if o.startupTaint != "" {
+			return fmt.Errorf("flag startup-taint can't be used together with metadata-only")
+		}
+		// taints aren't part of the metadata, every control-plane node would be labeled as worker
+		if o.controlPlaneLabelSelector == "" && o.controlPlaneNamePattern == "" && !o.controlPlaneMirrorPods && !o.clusterAPI {
+			return fmt.Errorf("flag metadata-only requires control-plane-label-selector, control-plane-name-pattern, control-plane-mirror-pods or cluster-api to detect control-plane nodes")
+		}
+	}
+	return nil
+}
+
+// controllerConfig builds the controller config from the flags. The returned
+// lookups have to be run before the controller relies on them.
+func (o *options) controllerConfig(client kubernetes.Interface) (controller.Config, lookups, error) {
+	var l lookups
+
+	var labelTemplates []controller.LabelTemplate
+	for _, rule := range o.labelTemplateRules {
+		t, err := controller.ParseLabelTemplate(rule)
+		if err != nil {
+			return controller.Config{}, l, fmt.Errorf("invalid label-template: %v", err)
+		}
+		labelTemplates = append(labelTemplates, t)
+	}
+
+	var conditionLabels []controller.ConditionLabel
+	for _, rule := range o.conditionLabelRules {
+		cl, err := controller.ParseConditionLabel(rule)
+		if err != nil {
+			return controller.Config{}, l, fmt.Errorf("invalid condition-label: %v", err)
+		}
+		conditionLabels = append(conditionLabels, cl)
+	}
+
+	var customRoleSources []controller.CustomRoleSource
+	for _, spec := range o.customRoleLabels {
+		source, err := controller.ParseCustomRoleSource(spec)
+		if err != nil {
+			return controller.Config{}, l, fmt.Errorf("invalid custom-role-label: %v", err)
+		}
+		customRoleSources = append(customRoleSources, source)
+	}
+
+	customRoleConflictPolicy, err := controller.ParseCustomRoleConflictPolicy(o.customRolePolicy)
+	if err != nil {
+		return controller.Config{}, l, fmt.Errorf("invalid custom-role-conflict-policy: %v", err)
+	}
+
+	roleLabelStyle, err := controller.ParseRoleLabelStyle(o.roleLabelStyle)
+	if err != nil {
+		return controller.Config{}, l, fmt.Errorf("invalid role-label-style: %v", err)
+	}
+	roleLabels := controller.RoleLabels{
+		Style:  roleLabelStyle,
+		Prefix: o.roleLabelPrefix,
+		Key:    o.roleLabelKey,
+	}
+	if err := roleLabels.Validate(); err != nil {
+		return controller.Config{}, l, fmt.Errorf("invalid role-label-prefix or role-label-key: %v", err)
+	}
+
+	controlPlaneTaints := o.controlPlaneTaints
+	if len(controlPlaneTaints) == 0 {
+		controlPlaneTaints = stringSliceFlag{controller.NodeRoleControlPlaneLabel}
+	}
+	controlPlaneDetectors := controlplane.Any{controlplane.NewTaintDetector(controlPlaneTaints...)}
+	if o.controlPlaneLabelSelector != "" {
+		d, err := controlplane.NewLabelDetector(o.controlPlaneLabelSelector)
+		if err != nil {
+			return controller.Config{}, l, fmt.Errorf("invalid control-plane-label-selector: %v", err)
+		}
+		controlPlaneDetectors = append(controlPlaneDetectors, d)
+	}
+	if o.controlPlaneNamePattern != "" {
+		d, err := controlplane.NewNameDetector(o.controlPlaneNamePattern)
+		if err != nil {
+			return controller.Config{}, l, fmt.Errorf("invalid control-plane-name-pattern: %v", err)
+		}
+		controlPlaneDetectors = append(controlPlaneDetectors, d)
+	}
+	if o.controlPlaneMirrorPods {
+		d := controlplane.NewMirrorPodDetector(client)
+		l.mirrorPods = &d
+		controlPlaneDetectors = append(controlPlaneDetectors, d)
+	}
+
+	var machines controller.MachineLookup
+	if o.clusterAPI {
+		kubeconfigPath := o.kubeconfig
+		if o.clusterAPIKubeconfig != "" {
+			kubeconfigPath = o.clusterAPIKubeconfig
+		}
+		dynamicClient, err := common.DynamicClientSet(kubeconfigPath)
+		if err != nil {
+			return controller.Config{}, l, fmt.Errorf("failed to create Cluster API dynamic client %v", err)
+		}
+		m := clusterapi.NewMachineLookup(dynamicClient, o.clusterAPINamespace, o.clusterAPIClusterName)
+		l.machines = &m
+		machines = m
+		controlPlaneDetectors = append(controlPlaneDetectors, m)
+	}
+
+	var nodeClaims controller.NodeClaimLookup
+	if o.karpenterEnabled && o.karpenterNodeClaims {
+		dynamicClient, err := common.DynamicClientSet(o.kubeconfig)
+		if err != nil {
+			return controller.Config{}, l, fmt.Errorf("failed to create Kubernetes dynamic client %v", err)
+		}
+		n := karpenter.NewNodeClaimLookup(dynamicClient)
+		l.nodeClaims = &n
+		nodeClaims = n
+	}
+
+	rolePrecedence, err := controller.ParseRolePrecedence(o.rolePrecedence)
+	if err != nil {
+		return controller.Config{}, l, fmt.Errorf("invalid role-precedence: %v", err)
+	}
+
+	nodeGroupMappers, err := controller.ParseNodeGroupMappers(o.managedNodeGroups)
+	if err != nil {
+		return controller.Config{}, l, fmt.Errorf("invalid managed-node-groups: %v", err)
+	}
+
+	nodeSelector, err := labels.Parse(o.nodeSelector)
+	if err != nil {
+		return controller.Config{}, l, fmt.Errorf("invalid node-selector: %v", err)
+	}
+
+	var metadataClient metadata.Interface
+	if o.metadataOnly {
+		log.Warn("Running metadata-only, taint based control-plane detection and uninitialized node checks are disabled")
+		metadataClient, err = common.MetadataClientSet(o.kubeconfig)
+		if err != nil {
+			return controller.Config{}, l, fmt.Errorf("failed to create Kubernetes metadata client %v", err)
+		}
+	}
+
+	var shards *controller.Shards
+	if o.shardCount > 1 {
+		shards = controller.NewShards(o.shardCount)
+	}
+
+	return controller.Config{
+		ExcludeLoadBalancing:    o.excludeNodeFromLoadbalancer,
+		IncludeAlphaLabel:       o.alphaFlags,
+		ExcludeEviction:         o.excludeEviction,
+		ControlPlaneDetector:    controlPlaneDetectors,
+		ControlPlaneLegacyLabel: o.controlPlaneLegacyLabel,
+		CustomRoleSources:       customRoleSources,
+		CustomRolePolicy:        customRoleConflictPolicy,
+		CustomRoleDelimiter:     o.customRoleDelimiter,
+		KarpenterEnabled:        o.karpenterEnabled,
+		KarpenterNodePoolRoles:  o.karpenterNodePoolRoles,
+		KarpenterCapacityType:   o.karpenterCapacityType,
+		NodeClaims:              nodeClaims,
+		Machines:                machines,
+		NodeGroupMappers:        nodeGroupMappers,
+		LabelTemplates:          labelTemplates,
+		ConditionLabels:         conditionLabels,
+		RolePrecedence:          rolePrecedence,
+		NodeSelector:            nodeSelector,
+		MetadataClient:          metadataClient,
+		ResyncPeriod:            o.resyncPeriod,
+		Shards:                  shards,
+		WaitForTaints:           o.waitForTaints,
+		PreLabel:                o.preLabel,
+		StartupTaint:            o.startupTaint,
+		Identity:                o.leaseId,
+		RoleLabels:              roleLabels,
+	}, l, nil
+}
+
+// auditSink returns the sinks of the audit flags, or nil if none is set. The
+// returned function closes the audit file.
+func (o *options) auditSink(client kubernetes.Interface) (audit.Sink, func(), error) {
+	closeFile := func() {}
+	var sinks audit.Multi
+	if o.auditFile != "" {
+		file, err := audit.NewFileSink(o.auditFile)
+		if err != nil {
+			return nil, closeFile, fmt.Errorf("failed to open audit-file: %v", err)
+		}
+		closeFile = func() { file.Close() }
+		sinks = append(sinks, file)
+	}
+	if o.auditConfigMap != "" {
+		sinks = append(sinks, audit.NewConfigMapSink(client, o.leaseLockNamespace, o.auditConfigMap, o.auditConfigMapSize))
+	}
+	if len(sinks) == 0 {
+		return nil, closeFile, nil
+	}
+	return sinks, closeFile, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	testCases := []struct {
+		name        string
+		args        []string
+		expected    command
+		expectedErr bool
+	}{
+		{name: "controller", expected: command{name: commandRun}},
+		{name: "explain", args: []string{"explain", "node-a"}, expected: command{name: commandExplain, node: "node-a"}},
+		{name: "explain without node", args: []string{"explain"}, expectedErr: true},
+		{name: "check asg templates", args: []string{"check-asg-templates"}, expected: command{name: commandCheckASGTemplates}},
+		{name: "unknown", args: []string{"label"}, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, err := parseCommand(tc.args)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cmd)
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		args        []string
+		cmd         command
+		expectedErr string
+	}{
+		{
+			name: "defaults",
+			args: []string{"-lease-lock-namespace=kube-system"},
+		},
+		{
+			name:        "missing lease namespace",
+			expectedErr: "flag lease-lock-namespace is not set and default value is not available",
+		},
+		{
+			name: "explain without lease namespace",
+			cmd:  command{name: commandExplain, node: "node-a"},
+		},
+		{
+			name:        "check asg templates without aws",
+			cmd:         command{name: commandCheckASGTemplates},
+			expectedErr: "subcommand check-asg-templates requires provider aws",
+		},
+		{
+			name:        "shards without leader election",
+			args:        []string{"-leader-elect=false", "-shards=2"},
+			expectedErr: "flag shards can't be used without leader-elect",
+		},
+		{
+			name:        "startup taint waited for",
+			args:        []string{"-lease-lock-namespace=kube-system", "-startup-taint=a", "-wait-for-taint=a"},
+			expectedErr: "flag startup-taint can't be one of the wait-for-taint taints",
+		},
+		{
+			name:        "metadata only without control-plane detection",
+			args:        []string{"-lease-lock-namespace=kube-system", "-metadata-only"},
+			expectedErr: "flag metadata-only requires control-plane-label-selector, control-plane-name-pattern, control-plane-mirror-pods or cluster-api to detect control-plane nodes",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			o := newOptions(fs, "")
+			assert.NoError(t, fs.Parse(tc.args))
+
+			err := o.validate(tc.cmd)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// serveHTTP serves handler on address for the lifetime of the process.
+func serveHTTP(address string, handler http.Handler) {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Infof("Serving HTTP on %s", address)
+	if err := server.ListenAndServe(); err != nil {
+		log.Errorf("HTTP server failed: %v", err)
+	}
+}
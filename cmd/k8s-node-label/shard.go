@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daspawnw/k8s-node-label/pkg/controller"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// shardElection competes for one lease per node shard. Every replica runs
+// its controller all the time, but only labels nodes of shards whose lease
+// it holds.
+type shardElection struct {
+	client             kubernetes.Interface
+	shards             *controller.Shards
+	maxShards          int
+	leaseLockName      string
+	leaseLockNamespace string
+	identity           string
+	leaseDuration      time.Duration
+	renewDeadline      time.Duration
+	retryPeriod        time.Duration
+	// onAcquired is called after a shard was taken over. ctx is cancelled
+	// once the shard lease is lost.
+	onAcquired func(ctx context.Context, shard int)
+}
+
+// releaseLease gives up the lease if it's still held by this replica, so other
+// replicas don't have to wait for it to expire.
+func releaseLease(lock *resourcelock.LeaseLock, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	record, _, err := lock.Get(ctx)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.WithError(err).WithField("lease", lock.LeaseMeta.Name).Warn("Can't get lease to release it")
+		}
+		return
+	}
+	if record.HolderIdentity != lock.Identity() {
+		return
+	}
+
+	now := metav1.NewTime(time.Now())
+	if err := lock.Update(ctx, resourcelock.LeaderElectionRecord{
+		LeaderTransitions:    record.LeaderTransitions,
+		LeaseDurationSeconds: 1,
+		RenewTime:            now,
+		AcquireTime:          now,
+	}); err != nil {
+		log.WithError(err).WithField("lease", lock.LeaseMeta.Name).Warn("Can't release lease")
+	}
+}
+
+func newLeaseLock(client kubernetes.Interface, name string, namespace string, identity string) *resourcelock.LeaseLock {
+	return &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Client: client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+}
+
+// run competes for all shards until ctx is cancelled and returns once every
+// held lease is released.
+func (e shardElection) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for shard := 0; shard < e.shards.Count(); shard++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.runShard(ctx, shard)
+		}()
+	}
+	wg.Wait()
+}
+
+// runShard competes for the lease of a single shard until ctx is cancelled.
+//
+// The leader election runs OnStartedLeading in a goroutine it doesn't wait for
+// and, with ReleaseOnCancel, releases the lease before that goroutine sees the
+// cancellation. So the lease is released here instead, after the callback gave
+// up the shard and returned, and another replica never writes the shard's
+// nodes at the same time.
+func (e shardElection) runShard(ctx context.Context, shard int) {
+	for ctx.Err() == nil {
+		shardCtx, shardCancel := context.WithCancel(ctx)
+		lock := newLeaseLock(e.client, fmt.Sprintf("%s-%d", e.leaseLockName, shard), e.leaseLockNamespace, e.identity)
+		var gaveUp atomic.Bool
+
+		var mu sync.Mutex
+		var stopped bool
+		var leading sync.WaitGroup
+
+		leaderelection.RunOrDie(shardCtx, leaderelection.LeaderElectionConfig{
+			Lock:          lock,
+			LeaseDuration: e.leaseDuration,
+			RenewDeadline: e.renewDeadline,
+			RetryPeriod:   e.retryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					mu.Lock()
+					if stopped {
+						mu.Unlock()
+						return
+					}
+					leading.Add(1)
+					mu.Unlock()
+					defer leading.Done()
+
+					if !e.shards.TryAcquire(shard, e.maxShards) {
+						// leave the shard to a replica with spare capacity
+						log.WithFields(log.Fields{"shard": shard, "max_shards": e.maxShards}).Debug("Give up shard, already owning the maximum number of shards")
+						gaveUp.Store(true)
+						shardCancel()
+						return
+					}
+					log.WithFields(log.Fields{"shard": shard, "shards": e.shards.Count()}).Info("Acquired shard")
+					e.onAcquired(ctx, shard)
+
+					<-ctx.Done()
+					e.shards.Release(shard)
+					log.WithFields(log.Fields{"shard": shard, "shards": e.shards.Count()}).Info("Released shard")
+				},
+				OnStoppedLeading: func() {
+					// the shard is released by OnStartedLeading
+				},
+			},
+		})
+		shardCancel()
+
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+		leading.Wait()
+		releaseLease(lock, e.renewDeadline)
+
+		wait := e.retryPeriod
+		if gaveUp.Load() {
+			wait = e.leaseDuration
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daspawnw/k8s-node-label/pkg/controller"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func testShardElection(client kubernetes.Interface, identity string, shards *controller.Shards, maxShards int, onAcquired func(ctx context.Context, shard int)) shardElection {
+	return shardElection{
+		client:             client,
+		shards:             shards,
+		maxShards:          maxShards,
+		leaseLockName:      "k8s-node-label",
+		leaseLockNamespace: "kube-system",
+		identity:           identity,
+		leaseDuration:      time.Second,
+		renewDeadline:      500 * time.Millisecond,
+		retryPeriod:        50 * time.Millisecond,
+		onAcquired:         onAcquired,
+	}
+}
+
+func leaseHolder(t *testing.T, client kubernetes.Interface, shard int) string {
+	lease, err := client.CoordinationV1().Leases("kube-system").Get(context.TODO(), fmt.Sprintf("k8s-node-label-%d", shard), metav1.GetOptions{})
+	assert.NoError(t, err)
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func TestShardElectionShouldSplitShardsBetweenReplicas(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	shardsA, shardsB := controller.NewShards(2), controller.NewShards(2)
+	var acquired atomic.Int32
+	onAcquired := func(ctx context.Context, shard int) {
+		acquired.Add(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, e := range []shardElection{
+		testShardElection(client, "replica-a", shardsA, 1, onAcquired),
+		testShardElection(client, "replica-b", shardsB, 1, onAcquired),
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.run(ctx)
+		}()
+	}
+
+	assert.Eventually(t, func() bool {
+		return acquired.Load() == 2
+	}, 10*time.Second, 10*time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	holders := []string{leaseHolder(t, client, 0), leaseHolder(t, client, 1)}
+	assert.Equal(t, []string{"", ""}, holders, "Expected leases to be released")
+	assert.False(t, shardsA.Owns("node-a") || shardsA.Owns("node-b"))
+	assert.False(t, shardsB.Owns("node-a") || shardsB.Owns("node-b"))
+}
+
+func TestShardElectionShouldStopProcessingBeforeReleasingLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	shards := controller.NewShards(1)
+	started := make(chan struct{})
+	var holderAfterProcessing atomic.Value
+
+	e := testShardElection(client, "replica-a", shards, 0, func(ctx context.Context, shard int) {
+		close(started)
+		<-ctx.Done()
+		// a slow node update still in flight when the lease is given up
+		time.Sleep(100 * time.Millisecond)
+		holderAfterProcessing.Store(leaseHolder(t, client, shard))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Shard wasn't acquired")
+	}
+	assert.True(t, shards.Owns("node-a"))
+	cancel()
+	<-done
+
+	assert.Equal(t, "replica-a", holderAfterProcessing.Load(), "Expected lease to be held until processing stopped")
+	assert.Equal(t, "", leaseHolder(t, client, 0))
+	assert.False(t, shards.Owns("node-a"))
+}
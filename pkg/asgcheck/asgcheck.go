@@ -0,0 +1,249 @@
+package asgcheck
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/daspawnw/k8s-node-label/pkg/spotdiscovery"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// NodeTemplateLabelTagPrefix is the ASG tag prefix Cluster Autoscaler
+	// predicts node labels from when scaling a group up from zero.
+	NodeTemplateLabelTagPrefix = "k8s.io/cluster-autoscaler/node-template/label/"
+	// describeInstancesBatchSize is the maximum number of instance ids per DescribeAutoScalingInstances call.
+	describeInstancesBatchSize = 50
+	// describeGroupsBatchSize is the number of group names per DescribeAutoScalingGroups call.
+	describeGroupsBatchSize = 50
+)
+
+// LabelSource returns the labels the controller sets on a node.
+type LabelSource interface {
+	ManagedLabels(node *v1.Node) map[string]string
+}
+
+// Checker compares the labels the controller sets on the nodes of each
+// auto scaling group with the node template labels the group advertises.
+type Checker struct {
+	autoscalingClient autoscalingiface.AutoScalingAPI
+	labels            LabelSource
+}
+
+func NewChecker(labels LabelSource) (Checker, error) {
+	awsSession, err := session.NewSession()
+	if err != nil {
+		return Checker{}, err
+	}
+	return Checker{
+		autoscalingClient: autoscaling.New(awsSession, &aws.Config{}),
+		labels:            labels,
+	}, nil
+}
+
+// Mismatch is a label set on nodes of a group but not advertised with the
+// same value by its node template. Advertised is empty for missing tags.
+type Mismatch struct {
+	Label      string `json:"label"`
+	Expected   string `json:"expected"`
+	Advertised string `json:"advertised"`
+}
+
+// GroupResult is the result of a single auto scaling group.
+type GroupResult struct {
+	Name       string     `json:"name"`
+	Nodes      []string   `json:"nodes"`
+	Mismatches []Mismatch `json:"mismatches"`
+	// Varying lists labels set on some nodes of the group only or with different
+	// values, they can't be predicted by a node template.
+	Varying []string `json:"varying"`
+}
+
+// Result is the result of a check. Groups without nodes can't be checked and are left out.
+type Result struct {
+	Groups []GroupResult `json:"groups"`
+	// Unmatched lists managed nodes not belonging to an auto scaling group.
+	Unmatched []string `json:"unmatched"`
+}
+
+// Consistent reports whether all groups advertise the labels of their nodes.
+func (r Result) Consistent() bool {
+	for _, g := range r.Groups {
+		if len(g.Mismatches) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Check compares the labels of nodes with the node templates of their groups.
+func (c Checker) Check(nodes []v1.Node) (Result, error) {
+	result := Result{Groups: []GroupResult{}, Unmatched: []string{}}
+
+	labelsByInstance := make(map[string]map[string]string)
+	nodeNames := make(map[string]string)
+	var instanceIDs []string
+	for i := range nodes {
+		node := &nodes[i]
+		labels := c.labels.ManagedLabels(node)
+		if labels == nil {
+			continue
+		}
+		instanceID, ok := spotdiscovery.InstanceID(node)
+		if !ok {
+			result.Unmatched = append(result.Unmatched, node.Name)
+			continue
+		}
+		labelsByInstance[instanceID] = labels
+		nodeNames[instanceID] = node.Name
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+
+	groups, err := c.groupsOf(instanceIDs)
+	if err != nil {
+		return Result{}, err
+	}
+	var names []string
+	for name, members := range groups {
+		names = append(names, name)
+		for _, instanceID := range members {
+			delete(nodeNames, instanceID)
+		}
+	}
+	for instanceID, nodeName := range nodeNames {
+		log.WithFields(log.Fields{"node": nodeName, "instance_id": instanceID}).Debug("Node doesn't belong to an auto scaling group")
+		result.Unmatched = append(result.Unmatched, nodeName)
+	}
+
+	templates, err := c.nodeTemplates(names)
+	if err != nil {
+		return Result{}, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		group := GroupResult{Name: name, Nodes: []string{}, Mismatches: []Mismatch{}, Varying: []string{}}
+		var memberLabels []map[string]string
+		for _, instanceID := range groups[name] {
+			memberLabels = append(memberLabels, labelsByInstance[instanceID])
+		}
+		expected, varying := commonLabels(memberLabels)
+		group.Varying = append(group.Varying, varying...)
+		for _, label := range sortedKeys(expected) {
+			if advertised, ok := templates[name][label]; !ok || advertised != expected[label] {
+				group.Mismatches = append(group.Mismatches, Mismatch{Label: label, Expected: expected[label], Advertised: advertised})
+			}
+		}
+		result.Groups = append(result.Groups, group)
+	}
+	for i := range result.Groups {
+		result.Groups[i].Nodes = groupNodeNames(nodes, groups[result.Groups[i].Name])
+	}
+
+	sort.Strings(result.Unmatched)
+	return result, nil
+}
+
+// commonLabels splits labels into those all nodes carry with the same value
+// and those that vary between them.
+func commonLabels(nodeLabels []map[string]string) (map[string]string, []string) {
+	common := make(map[string]string)
+	keys := make(map[string]bool)
+	for _, labels := range nodeLabels {
+		for k := range labels {
+			keys[k] = true
+		}
+	}
+
+	var varying []string
+	for _, k := range sortedKeys(keys) {
+		value, same := nodeLabels[0][k]
+		for _, labels := range nodeLabels[1:] {
+			if v, ok := labels[k]; !ok || v != value {
+				same = false
+				break
+			}
+		}
+		if same {
+			common[k] = value
+		} else {
+			varying = append(varying, k)
+		}
+	}
+	return common, varying
+}
+
+// groupNodeNames returns the sorted names of nodes running the instances.
+func groupNodeNames(nodes []v1.Node, instanceIDs []string) []string {
+	names := []string{}
+	for i := range nodes {
+		if instanceID, ok := spotdiscovery.InstanceID(&nodes[i]); ok && slices.Contains(instanceIDs, instanceID) {
+			names = append(names, nodes[i].Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// groupsOf looks up the auto scaling groups of the instances, keyed by group name.
+func (c Checker) groupsOf(instanceIDs []string) (map[string][]string, error) {
+	groups := make(map[string][]string)
+	for start := 0; start < len(instanceIDs); start += describeInstancesBatchSize {
+		end := min(start+describeInstancesBatchSize, len(instanceIDs))
+		input := &autoscaling.DescribeAutoScalingInstancesInput{
+			InstanceIds: aws.StringSlice(instanceIDs[start:end]),
+		}
+		err := c.autoscalingClient.DescribeAutoScalingInstancesPages(input, func(page *autoscaling.DescribeAutoScalingInstancesOutput, _ bool) bool {
+			for _, instance := range page.AutoScalingInstances {
+				name := aws.StringValue(instance.AutoScalingGroupName)
+				groups[name] = append(groups[name], aws.StringValue(instance.InstanceId))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// nodeTemplates returns the advertised node template labels of the groups, keyed by group name.
+func (c Checker) nodeTemplates(names []string) (map[string]map[string]string, error) {
+	templates := make(map[string]map[string]string)
+	for start := 0; start < len(names); start += describeGroupsBatchSize {
+		end := min(start+describeGroupsBatchSize, len(names))
+		input := &autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: aws.StringSlice(names[start:end]),
+		}
+		err := c.autoscalingClient.DescribeAutoScalingGroupsPages(input, func(page *autoscaling.DescribeAutoScalingGroupsOutput, _ bool) bool {
+			for _, group := range page.AutoScalingGroups {
+				labels := make(map[string]string)
+				for _, tag := range group.Tags {
+					if key := aws.StringValue(tag.Key); strings.HasPrefix(key, NodeTemplateLabelTagPrefix) {
+						labels[strings.TrimPrefix(key, NodeTemplateLabelTagPrefix)] = aws.StringValue(tag.Value)
+					}
+				}
+				templates[aws.StringValue(group.AutoScalingGroupName)] = labels
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
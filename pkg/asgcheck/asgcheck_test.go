@@ -0,0 +1,144 @@
+package asgcheck
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type MockAutoScalingClient struct {
+	autoscalingiface.AutoScalingAPI
+	// groups maps instance ids to their group
+	groups map[string]string
+	tags   map[string]map[string]string
+	// groupCalls counts the DescribeAutoScalingGroups calls
+	groupCalls int
+}
+
+func (m *MockAutoScalingClient) DescribeAutoScalingInstancesPages(input *autoscaling.DescribeAutoScalingInstancesInput, fn func(*autoscaling.DescribeAutoScalingInstancesOutput, bool) bool) error {
+	output := &autoscaling.DescribeAutoScalingInstancesOutput{}
+	for _, id := range aws.StringValueSlice(input.InstanceIds) {
+		if group, ok := m.groups[id]; ok {
+			output.AutoScalingInstances = append(output.AutoScalingInstances, &autoscaling.InstanceDetails{
+				InstanceId:           aws.String(id),
+				AutoScalingGroupName: aws.String(group),
+			})
+		}
+	}
+	fn(output, true)
+	return nil
+}
+
+func (m *MockAutoScalingClient) DescribeAutoScalingGroupsPages(input *autoscaling.DescribeAutoScalingGroupsInput, fn func(*autoscaling.DescribeAutoScalingGroupsOutput, bool) bool) error {
+	m.groupCalls++
+	if len(input.AutoScalingGroupNames) > describeGroupsBatchSize {
+		return fmt.Errorf("too many group names: %d", len(input.AutoScalingGroupNames))
+	}
+	output := &autoscaling.DescribeAutoScalingGroupsOutput{}
+	for _, name := range aws.StringValueSlice(input.AutoScalingGroupNames) {
+		group := &autoscaling.Group{AutoScalingGroupName: aws.String(name)}
+		for k, v := range m.tags[name] {
+			group.Tags = append(group.Tags, &autoscaling.TagDescription{Key: aws.String(k), Value: aws.String(v)})
+		}
+		output.AutoScalingGroups = append(output.AutoScalingGroups, group)
+	}
+	fn(output, true)
+	return nil
+}
+
+// testingLabels returns the labels of every node except "unmanaged".
+type testingLabels map[string]map[string]string
+
+func (l testingLabels) ManagedLabels(node *v1.Node) map[string]string {
+	return l[node.Name]
+}
+
+func node(name string, providerID string) v1.Node {
+	return v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1.NodeSpec{ProviderID: providerID},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	checker := Checker{
+		autoscalingClient: &MockAutoScalingClient{
+			groups: map[string]string{
+				"i-1": "spot-workers",
+				"i-2": "spot-workers",
+				"i-3": "workers",
+			},
+			tags: map[string]map[string]string{
+				"spot-workers": {
+					NodeTemplateLabelTagPrefix + "node.kubernetes.io/role": "worker",
+					"Name": "spot-workers",
+				},
+				"workers": {
+					NodeTemplateLabelTagPrefix + "node-role.kubernetes.io/worker": "",
+				},
+			},
+		},
+		labels: testingLabels{
+			"spot-1":     {"node-role.kubernetes.io/spot-worker": "", "node.kubernetes.io/role": "spot-worker", "node-role.kubernetes.io/gpu": ""},
+			"spot-2":     {"node-role.kubernetes.io/spot-worker": "", "node.kubernetes.io/role": "spot-worker"},
+			"worker":     {"node-role.kubernetes.io/worker": ""},
+			"standalone": {"node-role.kubernetes.io/worker": ""},
+			"on-prem":    {"node-role.kubernetes.io/worker": ""},
+		},
+	}
+
+	result, err := checker.Check([]v1.Node{
+		node("spot-1", "aws:///eu-central-1a/i-1"),
+		node("spot-2", "aws:///eu-central-1b/i-2"),
+		node("worker", "aws:///eu-central-1a/i-3"),
+		node("standalone", "aws:///eu-central-1a/i-4"),
+		node("on-prem", ""),
+		node("unmanaged", "aws:///eu-central-1a/i-5"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Result{
+		Groups: []GroupResult{
+			{
+				Name:  "spot-workers",
+				Nodes: []string{"spot-1", "spot-2"},
+				Mismatches: []Mismatch{
+					{Label: "node-role.kubernetes.io/spot-worker", Expected: ""},
+					{Label: "node.kubernetes.io/role", Expected: "spot-worker", Advertised: "worker"},
+				},
+				Varying: []string{"node-role.kubernetes.io/gpu"},
+			},
+			{
+				Name:       "workers",
+				Nodes:      []string{"worker"},
+				Mismatches: []Mismatch{},
+				Varying:    []string{},
+			},
+		},
+		Unmatched: []string{"on-prem", "standalone"},
+	}, result)
+	assert.False(t, result.Consistent())
+}
+
+func TestNodeTemplatesShouldBatchGroupNames(t *testing.T) {
+	client := &MockAutoScalingClient{tags: map[string]map[string]string{}}
+	var names []string
+	for i := 0; i < 120; i++ {
+		name := fmt.Sprintf("group-%d", i)
+		names = append(names, name)
+		client.tags[name] = map[string]string{NodeTemplateLabelTagPrefix + "team": name}
+	}
+	checker := Checker{autoscalingClient: client}
+
+	templates, err := checker.nodeTemplates(names)
+
+	assert.NoError(t, err)
+	assert.Len(t, templates, 120)
+	assert.Equal(t, map[string]string{"team": "group-119"}, templates["group-119"])
+	assert.Equal(t, 3, client.groupCalls)
+}
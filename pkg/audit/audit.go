@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record describes a single label change of a node.
+type Record struct {
+	Time        time.Time `json:"time"`
+	Node        string    `json:"node"`
+	Identity    string    `json:"identity"`
+	ReconcileID string    `json:"reconcileId"`
+	Reasons     []string  `json:"reasons"`
+	// Before holds the previous values of changed and removed labels, After
+	// the values of added and changed labels. Unchanged labels are left out.
+	Before map[string]string `json:"before"`
+	After  map[string]string `json:"after"`
+}
+
+// Diff returns the labels of before and after that differ, in the form
+// stored in Record.Before and Record.After.
+func Diff(before, after map[string]string) (map[string]string, map[string]string) {
+	changedBefore := make(map[string]string)
+	changedAfter := make(map[string]string)
+	for k, v := range before {
+		if newValue, ok := after[k]; !ok || newValue != v {
+			changedBefore[k] = v
+		}
+	}
+	for k, v := range after {
+		if oldValue, ok := before[k]; !ok || oldValue != v {
+			changedAfter[k] = v
+		}
+	}
+	return changedBefore, changedAfter
+}
+
+// Sink stores audit records.
+type Sink interface {
+	Write(record Record) error
+}
+
+// Multi writes records to all of its sinks.
+type Multi []Sink
+
+func (m Multi) Write(record Record) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FileSink appends records as JSON lines to a file.
+type FileSink struct {
+	mu   *sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens path for appending, creating it if needed.
+func NewFileSink(path string) (FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return FileSink{}, err
+	}
+	return FileSink{mu: &sync.Mutex{}, file: file}, nil
+}
+
+func (s FileSink) Write(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	// records must survive a crash right after the node update
+	return s.file.Sync()
+}
+
+// Close closes the underlying file.
+func (s FileSink) Close() error {
+	return s.file.Close()
+}
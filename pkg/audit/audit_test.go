@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func testRecord(node string) Record {
+	return Record{
+		Time:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Node:     node,
+		Identity: "replica-a",
+		Reasons:  []string{"Mark worker node"},
+		Before:   map[string]string{},
+		After:    map[string]string{"node-role.kubernetes.io/spot-worker": ""},
+	}
+}
+
+func TestFileSinkAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	for _, node := range []string{"node-a", "node-b"} {
+		sink, err := NewFileSink(path)
+		assert.NoError(t, err)
+		assert.NoError(t, sink.Write(testRecord(node)))
+		assert.NoError(t, sink.Close())
+	}
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var nodes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		nodes = append(nodes, record.Node)
+	}
+	assert.Equal(t, []string{"node-a", "node-b"}, nodes)
+}
+
+func TestConfigMapSinkKeepsLatestRecords(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	sink := NewConfigMapSink(clientset, "kube-system", "k8s-node-label-audit", 2)
+
+	for _, node := range []string{"node-a", "node-b", "node-c"} {
+		assert.NoError(t, sink.Write(testRecord(node)))
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps("kube-system").Get(context.TODO(), "k8s-node-label-audit", metav1.GetOptions{})
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(cm.Data[ConfigMapRecordsKey], "\n"), "\n")
+	assert.Len(t, lines, 2)
+
+	var record Record
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "node-b", record.Node)
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "node-c", record.Node)
+}
+
+func TestConfigMapSinkDropsOldestRecordsBeyondMaxBytes(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	sink := NewConfigMapSink(clientset, "kube-system", "k8s-node-label-audit", 200)
+	line, err := json.Marshal(testRecord("node-a"))
+	assert.NoError(t, err)
+	sink.maxBytes = 2*(len(line)+1) + 1
+
+	for _, node := range []string{"node-a", "node-b", "node-c"} {
+		assert.NoError(t, sink.Write(testRecord(node)))
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps("kube-system").Get(context.TODO(), "k8s-node-label-audit", metav1.GetOptions{})
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(cm.Data[ConfigMapRecordsKey], "\n"), "\n")
+	assert.Len(t, lines, 2)
+	assert.LessOrEqual(t, len(cm.Data[ConfigMapRecordsKey]), sink.maxBytes)
+
+	var record Record
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "node-b", record.Node)
+}
+
+func TestConfigMapSinkKeepsNewestRecordBeyondMaxBytes(t *testing.T) {
+	sink := NewConfigMapSink(fake.NewSimpleClientset(), "kube-system", "k8s-node-label-audit", 200)
+	sink.maxBytes = 1
+
+	assert.Equal(t, "b\n", sink.append("a\n", []byte("b")))
+}
+
+func TestDiff(t *testing.T) {
+	before, after := Diff(
+		map[string]string{"kubernetes.io/os": "linux", "team": "a", "node-role.kubernetes.io/master": ""},
+		map[string]string{"kubernetes.io/os": "linux", "team": "b", "node-role.kubernetes.io/control-plane": ""},
+	)
+
+	assert.Equal(t, map[string]string{"team": "a", "node-role.kubernetes.io/master": ""}, before)
+	assert.Equal(t, map[string]string{"team": "b", "node-role.kubernetes.io/control-plane": ""}, after)
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(Record) error {
+	return errors.New("unavailable")
+}
+
+func TestMultiWritesToAllSinks(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	sink := NewConfigMapSink(clientset, "kube-system", "audit", 10)
+
+	err := Multi{failingSink{}, sink}.Write(testRecord("node-a"))
+	assert.Error(t, err)
+
+	cm, err := clientset.CoreV1().ConfigMaps("kube-system").Get(context.TODO(), "audit", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, cm.Data[ConfigMapRecordsKey], "node-a")
+}
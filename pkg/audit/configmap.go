@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// ConfigMapRecordsKey is the ConfigMap data key holding the records as JSON lines.
+const ConfigMapRecordsKey = "records"
+
+// ConfigMapMaxBytes limits the size of the stored records, leaving headroom
+// below the 1 MiB limit of a ConfigMap.
+const ConfigMapMaxBytes = 768 * 1024
+
+// ConfigMapSink keeps the latest records as JSON lines in a ConfigMap, the
+// oldest records are dropped once size records or ConfigMapMaxBytes are stored.
+type ConfigMapSink struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	size      int
+	maxBytes  int
+}
+
+func NewConfigMapSink(client kubernetes.Interface, namespace string, name string, size int) ConfigMapSink {
+	return ConfigMapSink{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		size:      size,
+		maxBytes:  ConfigMapMaxBytes,
+	}
+}
+
+func (s ConfigMapSink) Write(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(context.TODO(), s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+				Data:       map[string]string{ConfigMapRecordsKey: string(line) + "\n"},
+			}
+			_, err = configMaps.Create(context.TODO(), cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// created concurrently, retry as update
+				return apierrors.NewConflict(v1.Resource("configmaps"), s.name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[ConfigMapRecordsKey] = s.append(cm.Data[ConfigMapRecordsKey], line)
+		_, err = configMaps.Update(context.TODO(), cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// append adds line to the JSON lines records and drops the oldest lines
+// exceeding the ring buffer size or its maximum bytes. The newest line is
+// always kept.
+func (s ConfigMapSink) append(records string, line []byte) string {
+	lines := strings.Split(strings.TrimSuffix(records, "\n"), "\n")
+	if records == "" {
+		lines = nil
+	}
+	lines = append(lines, string(line))
+	if len(lines) > s.size {
+		lines = lines[len(lines)-s.size:]
+	}
+	total := 0
+	for _, l := range lines {
+		total += len(l) + 1
+	}
+	for len(lines) > 1 && total > s.maxBytes {
+		total -= len(lines[0]) + 1
+		lines = lines[1:]
+	}
+
+	var b bytes.Buffer
+	for _, l := range lines {
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package clusterapi
+
+import (
+	"time"
+
+	"github.com/daspawnw/k8s-node-label/pkg/common"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+)
+
+const (
+	ClusterNameLabel      = "cluster.x-k8s.io/cluster-name"
+	ControlPlaneLabel     = "cluster.x-k8s.io/control-plane"
+	DeploymentNameLabel   = "cluster.x-k8s.io/deployment-name"
+	MachinePoolNameLabel  = "cluster.x-k8s.io/pool-name"
+	machineResyncInterval = 10 * time.Minute
+)
+
+// MachineResource is the resource Cluster API creates for every node.
+var MachineResource = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machines"}
+
+// MachineLookup finds the Machine of a node through its node reference or
+// provider ID. Machines usually live in a management cluster, so the
+// dynamic client may point to another cluster than the nodes.
+type MachineLookup struct {
+	machines common.NodeObjectLookup
+}
+
+// NewMachineLookup watches Machines in namespace, or all namespaces if it's
+// empty. A non-empty clusterName restricts it to Machines of that cluster.
+func NewMachineLookup(client dynamic.Interface, namespace string, clusterName string) MachineLookup {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, machineResyncInterval, namespace, func(options *metav1.ListOptions) {
+		if clusterName != "" {
+			options.LabelSelector = ClusterNameLabel + "=" + clusterName
+		}
+	})
+	return MachineLookup{
+		machines: common.NewNodeObjectLookup(factory, MachineResource,
+			[]string{"status", "nodeRef", "name"}, []string{"spec", "providerID"}),
+	}
+}
+
+// Run starts watching Machines and blocks until the cache is synced.
+func (l MachineLookup) Run(stopCh <-chan struct{}) {
+	l.machines.Run(stopCh)
+}
+
+// OnNodeChange calls f with the node name of every Machine that's added or
+// changes, e.g. once its node reference is set or it moves to another pool.
+func (l MachineLookup) OnNodeChange(f func(nodeName string)) {
+	l.machines.OnNodeChange(f)
+}
+
+// machine returns the Machine of node, or nil if there is none.
+func (l MachineLookup) machine(node *v1.Node) *unstructured.Unstructured {
+	return l.machines.Object(node)
+}
+
+// HasMachine reports whether a Machine of node is cached.
+func (l MachineLookup) HasMachine(node *v1.Node) bool {
+	return l.machine(node) != nil
+}
+
+// IsControlPlane reports whether the Machine of node belongs to the control plane.
+func (l MachineLookup) IsControlPlane(node *v1.Node) bool {
+	m := l.machine(node)
+	if m == nil {
+		return false
+	}
+	_, ok := m.GetLabels()[ControlPlaneLabel]
+	return ok
+}
+
+// MachinePool returns the name of the MachineDeployment or MachinePool the
+// Machine of node belongs to, or an empty string if there is none.
+func (l MachineLookup) MachinePool(node *v1.Node) string {
+	m := l.machine(node)
+	if m == nil {
+		return ""
+	}
+	labels := m.GetLabels()
+	if name := labels[DeploymentNameLabel]; name != "" {
+		return name
+	}
+	if name := labels[MachinePoolNameLabel]; name != "" {
+		return name
+	}
+	for _, owner := range m.GetOwnerReferences() {
+		if owner.Kind == "MachinePool" {
+			return owner.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package clusterapi
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func machine(name string, nodeName string, providerID string, labels map[string]interface{}, owners ...interface{}) *unstructured.Unstructured {
+	labels[ClusterNameLabel] = "workload"
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cluster.x-k8s.io/v1beta1",
+		"kind":       "Machine",
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       "default",
+			"labels":          labels,
+			"ownerReferences": owners,
+		},
+		"spec": map[string]interface{}{
+			"providerID": providerID,
+		},
+		"status": map[string]interface{}{
+			"nodeRef": map[string]interface{}{"name": nodeName},
+		},
+	}}
+}
+
+func TestMachineLookup(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{MachineResource: "MachineList"},
+		machine("cp-abcde", "cp-node", "", map[string]interface{}{ControlPlaneLabel: ""}),
+		machine("md-0-fghij", "md-node", "", map[string]interface{}{DeploymentNameLabel: "md-0"}),
+		machine("mp-0-klmno", "", "aws:///eu-central-1a/i-1", map[string]interface{}{},
+			map[string]interface{}{"apiVersion": "cluster.x-k8s.io/v1beta1", "kind": "MachinePool", "name": "mp-0", "uid": "1"}),
+	)
+	lookup := NewMachineLookup(client, "", "workload")
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	lookup.Run(stopCh)
+
+	testCases := []struct {
+		name         string
+		node         *v1.Node
+		controlPlane bool
+		pool         string
+	}{
+		{
+			name:         "control-plane machine",
+			node:         &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "cp-node"}},
+			controlPlane: true,
+		},
+		{
+			name: "machine deployment",
+			node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "md-node"}},
+			pool: "md-0",
+		},
+		{
+			name: "machine pool by provider id",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mp-node"},
+				Spec:       v1.NodeSpec{ProviderID: "aws:///eu-central-1a/i-1"},
+			},
+			pool: "mp-0",
+		},
+		{
+			name: "without machine",
+			node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.name != "without machine", lookup.HasMachine(tc.node))
+			assert.Equal(t, tc.controlPlane, lookup.IsControlPlane(tc.node))
+			assert.Equal(t, tc.pool, lookup.MachinePool(tc.node))
+		})
+	}
+}
+
+func TestMachineLookupShouldNotifyOnNodeChange(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{MachineResource: "MachineList"},
+		machine("md-0-fghij", "", "", map[string]interface{}{DeploymentNameLabel: "md-0"}),
+	)
+	lookup := NewMachineLookup(client, "", "workload")
+	var mu sync.Mutex
+	var nodes []string
+	lookup.OnNodeChange(func(nodeName string) {
+		mu.Lock()
+		defer mu.Unlock()
+		nodes = append(nodes, nodeName)
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	lookup.Run(stopCh)
+
+	// the node reference is set once the node registered
+	updated := machine("md-0-fghij", "md-node", "", map[string]interface{}{DeploymentNameLabel: "md-0"})
+	updated.SetResourceVersion("2")
+	_, err := client.Resource(MachineResource).Namespace("default").Update(context.TODO(), updated, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(nodes) == 1 && nodes[0] == "md-node"
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -3,7 +3,9 @@ package common
 import (
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -19,25 +21,39 @@ func CopyNodeObj(node *v1.Node) *v1.Node {
 }
 
 func ClientSet(kubeconfig string) (kubernetes.Interface, error) {
-	var config *rest.Config
-	if kubeconfig != "" {
-		log.Debug("Use kubeconfig provided by commandline flag")
-		conf, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			return nil, err
-		}
-
-		config = conf
-	} else {
-		log.Debug("Use in-cluster k8s configuration")
-		conf, err := rest.InClusterConfig()
-		if err != nil {
-			return nil, err
-		}
-
-		config = conf
+	config, err := RestConfig(kubeconfig)
+	if err != nil {
+		return nil, err
 	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	return clientset, err
 }
+
+func MetadataClientSet(kubeconfig string) (metadata.Interface, error) {
+	config, err := RestConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata.NewForConfig(config)
+}
+
+func DynamicClientSet(kubeconfig string) (dynamic.Interface, error) {
+	config, err := RestConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamic.NewForConfig(config)
+}
+
+func RestConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		log.Debug("Use kubeconfig provided by commandline flag")
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+
+	log.Debug("Use in-cluster k8s configuration")
+	return rest.InClusterConfig()
+}
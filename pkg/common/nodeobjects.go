@@ -0,0 +1,119 @@
+package common
+
+import (
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	nodeNameIndex   = "nodeName"
+	providerIDIndex = "providerID"
+)
+
+// NodeObjectLookup finds the object a node was created from, e.g. a
+// Karpenter NodeClaim or a Cluster API Machine, through the node name or
+// provider ID the object refers to.
+type NodeObjectLookup struct {
+	factory        dynamicinformer.DynamicSharedInformerFactory
+	informer       cache.SharedIndexInformer
+	resource       schema.GroupVersionResource
+	nodeNameFields []string
+}
+
+// NewNodeObjectLookup watches resource through factory and indexes its objects
+// by the nested string fields holding the node name and the provider ID.
+func NewNodeObjectLookup(factory dynamicinformer.DynamicSharedInformerFactory, resource schema.GroupVersionResource, nodeNameFields []string, providerIDFields []string) NodeObjectLookup {
+	informer := factory.ForResource(resource).Informer()
+	err := informer.AddIndexers(cache.Indexers{
+		nodeNameIndex:   fieldIndex(nodeNameFields),
+		providerIDIndex: fieldIndex(providerIDFields),
+	})
+	if err != nil {
+		log.Errorf("Failed to add indexes to %s informer: %v", resource.Resource, err)
+	}
+
+	return NodeObjectLookup{
+		factory:        factory,
+		informer:       informer,
+		resource:       resource,
+		nodeNameFields: nodeNameFields,
+	}
+}
+
+// fieldIndex indexes objects by a nested string field.
+func fieldIndex(fields []string) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, nil
+		}
+		value, _, _ := unstructured.NestedString(u.Object, fields...)
+		if value == "" {
+			return nil, nil
+		}
+		return []string{value}, nil
+	}
+}
+
+// Run starts watching the resource and blocks until the cache is synced.
+func (l NodeObjectLookup) Run(stopCh <-chan struct{}) {
+	l.factory.Start(stopCh)
+	l.factory.WaitForCacheSync(stopCh)
+}
+
+// Object returns the object of node, or nil if there is none.
+func (l NodeObjectLookup) Object(node *v1.Node) *unstructured.Unstructured {
+	indexer := l.informer.GetIndexer()
+	for _, lookup := range []struct{ index, value string }{
+		{nodeNameIndex, node.Name},
+		{providerIDIndex, node.Spec.ProviderID},
+	} {
+		if lookup.value == "" {
+			continue
+		}
+		objs, err := indexer.ByIndex(lookup.index, lookup.value)
+		if err != nil {
+			log.WithField("node", node.Name).Errorf("Failed to look up %s: %v", l.resource.Resource, err)
+			return nil
+		}
+		for _, obj := range objs {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+// OnNodeChange calls f with the name of the referenced node whenever an
+// object is added or changes. Objects not referring to a node by name yet
+// and resyncs are skipped.
+func (l NodeObjectLookup) OnNodeChange(f func(nodeName string)) {
+	notify := func(obj interface{}) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return
+		}
+		if name, _, _ := unstructured.NestedString(u.Object, l.nodeNameFields...); name != "" {
+			f(name)
+		}
+	}
+	_, err := l.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: notify,
+		UpdateFunc: func(old, new interface{}) {
+			oldObj, oldOk := old.(*unstructured.Unstructured)
+			newObj, newOk := new.(*unstructured.Unstructured)
+			if oldOk && newOk && oldObj.GetResourceVersion() == newObj.GetResourceVersion() {
+				return
+			}
+			notify(new)
+		},
+	})
+	if err != nil {
+		log.Errorf("Failed to add event handler to %s informer: %v", l.resource.Resource, err)
+	}
+}
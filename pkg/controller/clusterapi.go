@@ -0,0 +1,27 @@
+package controller
+
+import v1 "k8s.io/api/core/v1"
+
+// MachineLookup returns the name of the Cluster API MachineDeployment or
+// MachinePool a node belongs to, or an empty string if there is none.
+// HasMachine reports whether the Machine of a node is cached at all.
+type MachineLookup interface {
+	MachinePool(node *v1.Node) string
+	HasMachine(node *v1.Node) bool
+}
+
+// machinePoolRole returns the role named after the machine pool of a node,
+// or an empty string if no Machine lookup is configured.
+func (c NodeController) machinePoolRole(node *v1.Node) string {
+	if c.machines == nil {
+		return ""
+	}
+	return c.machines.MachinePool(node)
+}
+
+// isMachinePending reports whether node has no Machine cached yet although a
+// Machine lookup is configured. Cluster API creates a Machine for every node,
+// it may just not have reached the cache.
+func (c NodeController) isMachinePending(node *v1.Node) bool {
+	return c.machines != nil && !c.machines.HasMachine(node)
+}
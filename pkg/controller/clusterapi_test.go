@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+type testingMachines map[string]string
+
+func (m testingMachines) MachinePool(node *v1.Node) string {
+	return m[node.Name]
+}
+
+func (m testingMachines) HasMachine(node *v1.Node) bool {
+	_, ok := m[node.Name]
+	return ok
+}
+
+func TestMachinePoolRole(t *testing.T) {
+	testCases := []struct {
+		name           string
+		config         Config
+		expectedLabels map[string]string
+	}{
+		{
+			name:   "machine pool role",
+			config: Config{Machines: testingMachines{WorkerNode.Name: "md-0"}},
+			expectedLabels: map[string]string{
+				NodeRoleWorkerLabel:            "",
+				"node-role.kubernetes.io/md-0": "",
+			},
+		},
+		{
+			name:   "machine pool role is exclusive",
+			config: Config{Machines: testingMachines{WorkerNode.Name: "md-0"}, RolePrecedence: []string{"md-0", RoleWorker}},
+			expectedLabels: map[string]string{
+				"node-role.kubernetes.io/md-0": "",
+			},
+		},
+		{
+			name:   "node without machine",
+			config: Config{Machines: testingMachines{}},
+			expectedLabels: map[string]string{
+				NodeRoleWorkerLabel: "",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(WorkerNode)
+			c := NewNodeController(clientset, TestingMockDiscovery{}, tc.config)
+			c.handler(WorkerNode)
+
+			foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), WorkerNode.Name, metav1.GetOptions{})
+			assert.Equal(t, tc.expectedLabels, foundNode.Labels)
+		})
+	}
+}
+
+func TestReconcileNodeShouldLabelCachedNode(t *testing.T) {
+	clientset := fake.NewSimpleClientset(WorkerNode)
+	machines := testingMachines{}
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{Machines: machines})
+	c.store.Add(WorkerNode)
+
+	// the machine of the node shows up after the node was labeled
+	machines[WorkerNode.Name] = "md-0"
+	c.ReconcileNode(WorkerNode.Name)
+	c.ReconcileNode("unknown-node")
+
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), WorkerNode.Name, metav1.GetOptions{})
+	assert.Contains(t, foundNode.Labels, "node-role.kubernetes.io/md-0")
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ConditionRequirement requires a node condition to have a status.
+type ConditionRequirement struct {
+	Type   v1.NodeConditionType
+	Status v1.ConditionStatus
+}
+
+// ConditionLabel is set while all of its conditions are met and removed as
+// soon as one of them isn't, turning node conditions into schedulable labels.
+type ConditionLabel struct {
+	Key        string
+	Value      string
+	Conditions []ConditionRequirement
+}
+
+// ParseConditionLabel parses a rule in the form KEY=VALUE:TYPE[=STATUS][,TYPE[=STATUS]].
+// Conditions without a status require True.
+func ParseConditionLabel(spec string) (ConditionLabel, error) {
+	label, conditions, found := strings.Cut(spec, ":")
+	if !found {
+		return ConditionLabel{}, fmt.Errorf("condition label %q is missing the conditions after ':'", spec)
+	}
+	key, value, found := strings.Cut(label, "=")
+	if !found {
+		return ConditionLabel{}, fmt.Errorf("condition label %q is missing '=' between key and value", spec)
+	}
+	if errs := validateLabel(key, value); len(errs) > 0 {
+		return ConditionLabel{}, fmt.Errorf("condition label %q is invalid: %s", spec, strings.Join(errs, "; "))
+	}
+
+	l := ConditionLabel{Key: key, Value: value}
+	for _, condition := range strings.Split(conditions, ",") {
+		conditionType, status, found := strings.Cut(strings.TrimSpace(condition), "=")
+		if !found {
+			status = string(v1.ConditionTrue)
+		}
+		switch s := v1.ConditionStatus(status); s {
+		case v1.ConditionTrue, v1.ConditionFalse, v1.ConditionUnknown:
+		default:
+			return ConditionLabel{}, fmt.Errorf("condition label %q has an unknown status %q, available values: (True, False, Unknown)", spec, status)
+		}
+		if conditionType == "" {
+			return ConditionLabel{}, fmt.Errorf("condition label %q has an empty condition type", spec)
+		}
+		l.Conditions = append(l.Conditions, ConditionRequirement{
+			Type:   v1.NodeConditionType(conditionType),
+			Status: v1.ConditionStatus(status),
+		})
+	}
+	return l, nil
+}
+
+func (l ConditionLabel) String() string {
+	var conditions []string
+	for _, c := range l.Conditions {
+		conditions = append(conditions, string(c.Type)+"="+string(c.Status))
+	}
+	return fmt.Sprintf("%s=%s:%s", l.Key, l.Value, strings.Join(conditions, ","))
+}
+
+// met reports whether all conditions have the required status. Missing
+// conditions aren't met.
+func (l ConditionLabel) met(node *v1.Node) bool {
+	for _, required := range l.Conditions {
+		found := false
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == required.Type {
+				found = condition.Status == required.Status
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
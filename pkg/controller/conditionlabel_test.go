@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseConditionLabel(t *testing.T) {
+	l, err := ParseConditionLabel("example.com/ingress-ready=true:Ready,NetworkUnavailable=False")
+	assert.NoError(t, err)
+	assert.Equal(t, ConditionLabel{
+		Key:   "example.com/ingress-ready",
+		Value: "true",
+		Conditions: []ConditionRequirement{
+			{Type: v1.NodeReady, Status: v1.ConditionTrue},
+			{Type: v1.NodeNetworkUnavailable, Status: v1.ConditionFalse},
+		},
+	}, l)
+	assert.Equal(t, "example.com/ingress-ready=true:Ready=True,NetworkUnavailable=False", l.String())
+
+	l, err = ParseConditionLabel("example.com/gpu-ready=:GPUDriverReady")
+	assert.NoError(t, err)
+	assert.Equal(t, "", l.Value)
+
+	for _, spec := range []string{"example.com/ready=true", "example.com/ready:Ready", "in valid=true:Ready", "example.com/ready=true:Ready=Maybe", "example.com/ready=true:"} {
+		_, err := ParseConditionLabel(spec)
+		assert.Errorf(t, err, "Expected error for spec %q", spec)
+	}
+}
+
+func TestHandlerShouldFollowConditionLabels(t *testing.T) {
+	ready, _ := ParseConditionLabel("example.com/ingress-ready=true:Ready,CNIReady")
+
+	node := WorkerNode.DeepCopy()
+	node.Labels = map[string]string{NodeRoleWorkerLabel: ""}
+	node.Status.Conditions = []v1.NodeCondition{
+		{Type: v1.NodeReady, Status: v1.ConditionTrue},
+		{Type: "CNIReady", Status: v1.ConditionTrue},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{ConditionLabels: []ConditionLabel{ready}})
+
+	c.handler(node)
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Equal(t, "true", foundNode.Labels["example.com/ingress-ready"])
+
+	foundNode.Status.Conditions[1].Status = v1.ConditionFalse
+	c.handler(foundNode)
+	foundNode, _ = clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Equal(t, map[string]string{NodeRoleWorkerLabel: ""}, foundNode.Labels)
+
+	foundNode.Status.Conditions = foundNode.Status.Conditions[:1]
+	c.handler(foundNode)
+	foundNode, _ = clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.NotContains(t, foundNode.Labels, "example.com/ingress-ready")
+}
@@ -2,30 +2,139 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/daspawnw/k8s-node-label/pkg/audit"
 	"github.com/daspawnw/k8s-node-label/pkg/common"
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
 	"github.com/daspawnw/k8s-node-label/pkg/spotdiscovery"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
+var tracer = otel.Tracer("github.com/daspawnw/k8s-node-label/pkg/controller")
+
 type NodeController struct {
 	client                  kubernetes.Interface
 	Controller              cache.Controller
+	store                   cache.Store
 	includeAlphaLabel       bool
 	excludeLoadBalancing    bool
 	excludeEviction         bool
 	spotInstanceDiscovery   spotdiscovery.SpotDiscoveryInterface
-	controlPlaneTaint       string
+	controlPlaneDetector    controlplane.Detector
 	controlPlaneLegacyLabel bool
-	customRoleLabel         string
+	customRoleSources       []CustomRoleSource
+	customRolePolicy        CustomRoleConflictPolicy
+	customRoleDelimiter     string
 	karpenterEnabled        bool
+	karpenterNodePoolRoles  bool
+	karpenterCapacityType   bool
+	nodeClaims              NodeClaimLookup
+	machines                MachineLookup
+	nodeGroupMappers        []NodeGroupMapper
+	labelTemplates          []LabelTemplate
+	conditionLabels         []ConditionLabel
+	roleLabels              RoleLabels
+	rolePrecedence          []string
+	nodeSelector            labels.Selector
+	metadataClient          metadata.Interface
+	shards                  *Shards
+	eventBroadcaster        record.EventBroadcaster
+	recorder                record.EventRecorder
+	// logger is the base logger of every reconcile, which adds its node fields.
+	logger    log.FieldLogger
+	auditSink audit.Sink
+	identity  string
+	// waitForTaints mark nodes not yet initialized, they're requeued with backoff.
+	waitForTaints []string
+	// uninitialized queues nodes not yet initialized or whose labels can't be resolved yet.
+	uninitialized workqueue.TypedRateLimitingInterface[string]
+	preLabel      bool
+	startupTaint  string
+}
+
+// reconcile holds the state of a single evaluation of a node. NodeController
+// is shared by all events, so this state is passed along explicitly.
+type reconcile struct {
+	// id correlates the log messages and audit records of the evaluation.
+	id     string
+	logger log.FieldLogger
+	// skipPrimaryRole is set while pre-labeling nodes whose spot state isn't known yet.
+	skipPrimaryRole bool
+}
+
+// Config holds the labeling options of a NodeController.
+type Config struct {
+	ExcludeLoadBalancing bool
+	IncludeAlphaLabel    bool
+	ExcludeEviction      bool
+	// ControlPlaneDetector decides whether a node is a control-plane node. Defaults to the control-plane taint.
+	ControlPlaneDetector    controlplane.Detector
+	ControlPlaneLegacyLabel bool
+	CustomRoleSources       []CustomRoleSource
+	// CustomRolePolicy decides between disagreeing custom role sources. Defaults to CustomRoleConflictAll.
+	CustomRolePolicy CustomRoleConflictPolicy
+	// CustomRoleDelimiter splits custom role label values into multiple roles. Empty disables splitting.
+	CustomRoleDelimiter string
+	KarpenterEnabled    bool
+	// KarpenterNodePoolRoles adds a node-role.kubernetes.io/<nodepool> label to Karpenter nodes.
+	KarpenterNodePoolRoles bool
+	// KarpenterCapacityType decides spot nodes by karpenter.sh/capacity-type instead of asking the spot provider.
+	KarpenterCapacityType bool
+	// NodeClaims provides the Karpenter labels of nodes not carrying them yet. Nil only uses node labels.
+	NodeClaims NodeClaimLookup
+	// Machines adds a role named after the Cluster API machine pool of a node. Nil disables it.
+	Machines MachineLookup
+	// NodeGroupMappers derive a role and the spot state from the labels of managed node groups.
+	NodeGroupMappers []NodeGroupMapper
+	LabelTemplates   []LabelTemplate
+	// ConditionLabels are set while their node conditions are met and removed otherwise.
+	ConditionLabels []ConditionLabel
+	RoleLabels      RoleLabels
+	// RolePrecedence lists exclusive roles, the first one a node qualifies for becomes its only primary role.
+	// Empty keeps all roles additive.
+	RolePrecedence []string
+	// NodeSelector restricts the nodes watched by the controller. Nil selects all nodes.
+	NodeSelector labels.Selector
+	// MetadataClient switches the controller to a metadata-only node informer. Taints and
+	// the provider ID aren't available then, so taint based detection and spot discovery don't work.
+	MetadataClient metadata.Interface
+	// ResyncPeriod is the interval in which all nodes are reprocessed. Defaults to DefaultResyncPeriod.
+	ResyncPeriod time.Duration
+	// Shards restricts the controller to nodes of shards owned by this replica. Nil manages all nodes.
+	Shards *Shards
+	// AuditSink records every label change of a node. Nil disables auditing.
+	AuditSink audit.Sink
+	// Identity is the lease holder identity written to audit records.
+	Identity string
+	// WaitForTaints lists taints marking nodes as not yet initialized. Defaults to NodeUninitialziedTaint.
+	WaitForTaints []string
+	// PreLabel applies labels that don't depend on the spot provider before a node is initialized.
+	PreLabel bool
+	// StartupTaint is removed from initialized nodes together with their labels. Empty disables it.
+	StartupTaint string
 }
 
 const (
@@ -41,245 +150,583 @@ const (
 	NodeUninitialziedTaint        = "node.cloudprovider.kubernetes.io/uninitialized"
 	NodeKarpenterManagedLabelKey  = "karpenter.sh/nodepool"
 	NodeKarpenterLabel            = "node-role.kubernetes.io/karpenter"
+	NodeKarpenterCapacityTypeKey  = "karpenter.sh/capacity-type"
+	NodeKarpenterUnregistered     = "karpenter.sh/unregistered"
+	KarpenterCapacityTypeSpot     = "spot"
+	IgnoreNodeKey                 = "k8s-node-label.io/ignore"
+	DefaultResyncPeriod           = 60 * time.Second
+	EventComponent                = "k8s-node-label"
+	EventReasonInvalidCustomRole  = "InvalidCustomRole"
+	EventReasonInvalidLabel       = "InvalidLabel"
 )
 
-func NewNodeController(client kubernetes.Interface, spotInstanceDiscovery spotdiscovery.SpotDiscoveryInterface, excludeLoadBalancing bool, includeAlphaLabel bool, excludeEviction bool, controlPlaneTaint string, controlPlaneLegacyLabel bool, customRoleLabel string, karpenterEnabled bool) NodeController {
+func NewNodeController(client kubernetes.Interface, spotInstanceDiscovery spotdiscovery.SpotDiscoveryInterface, config Config) NodeController {
 	c := NodeController{
 		client:                  client,
-		includeAlphaLabel:       includeAlphaLabel,
-		excludeLoadBalancing:    excludeLoadBalancing,
-		excludeEviction:         excludeEviction,
+		includeAlphaLabel:       config.IncludeAlphaLabel,
+		excludeLoadBalancing:    config.ExcludeLoadBalancing,
+		excludeEviction:         config.ExcludeEviction,
 		spotInstanceDiscovery:   spotInstanceDiscovery,
-		controlPlaneTaint:       controlPlaneTaint,
-		controlPlaneLegacyLabel: controlPlaneLegacyLabel,
-		customRoleLabel:         customRoleLabel,
-		karpenterEnabled:        karpenterEnabled,
+		controlPlaneDetector:    config.ControlPlaneDetector,
+		controlPlaneLegacyLabel: config.ControlPlaneLegacyLabel,
+		customRoleSources:       config.CustomRoleSources,
+		customRolePolicy:        config.CustomRolePolicy,
+		customRoleDelimiter:     config.CustomRoleDelimiter,
+		karpenterEnabled:        config.KarpenterEnabled,
+		karpenterNodePoolRoles:  config.KarpenterNodePoolRoles,
+		karpenterCapacityType:   config.KarpenterCapacityType,
+		nodeClaims:              config.NodeClaims,
+		machines:                config.Machines,
+		nodeGroupMappers:        config.NodeGroupMappers,
+		labelTemplates:          config.LabelTemplates,
+		conditionLabels:         config.ConditionLabels,
+		roleLabels:              config.RoleLabels.withDefaults(),
+		rolePrecedence:          config.RolePrecedence,
+		nodeSelector:            listSelector(config.NodeSelector),
+		metadataClient:          config.MetadataClient,
+		shards:                  config.Shards,
+		logger:                  log.StandardLogger(),
+		auditSink:               config.AuditSink,
+		identity:                config.Identity,
+		waitForTaints:           config.WaitForTaints,
+		uninitialized:           newUninitializedQueue(),
+		preLabel:                config.PreLabel,
+		startupTaint:            config.StartupTaint,
 	}
 
-	nodeListWatcher := cache.NewListWatchFromClient(
-		client.CoreV1().RESTClient(),
-		"nodes",
-		v1.NamespaceAll,
-		fields.Everything())
+	if len(c.waitForTaints) == 0 {
+		c.waitForTaints = []string{NodeUninitialziedTaint}
+	}
 
-	_, controller := cache.NewInformer(nodeListWatcher,
-		&v1.Node{},
-		60*time.Second,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    c.handler,
-			UpdateFunc: func(old, new interface{}) { c.handler(new) },
-		},
-	)
+	if c.customRolePolicy == "" {
+		c.customRolePolicy = CustomRoleConflictAll
+	}
 
-	c.Controller = controller
+	if c.controlPlaneDetector == nil {
+		c.controlPlaneDetector = controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)
+	}
+
+	c.eventBroadcaster = record.NewBroadcaster()
+	c.eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	c.recorder = c.eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: EventComponent})
+
+	resyncPeriod := config.ResyncPeriod
+	if resyncPeriod == 0 {
+		resyncPeriod = DefaultResyncPeriod
+	}
+	c.store, c.Controller = c.newInformer(resyncPeriod)
 
 	return c
 }
 
+// Run processes node events until stopCh is closed. It returns after the
+// node currently being processed is done and pending events are flushed.
+func (c NodeController) Run(stopCh <-chan struct{}) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.runUninitializedQueue(stopCh)
+	}()
+	c.Controller.Run(stopCh)
+	wg.Wait()
+	c.eventBroadcaster.Shutdown()
+	log.Info("Node controller stopped")
+}
+
+// handler reconciles a node on informer events. An uninitialized node is
+// queued once, requeuing it with backoff is left to the queue worker.
 func (c NodeController) handler(obj interface{}) {
-	node, ok := obj.(*v1.Node)
+	c.reconcileNode(obj, false)
+}
+
+// ReconcileNode labels the cached node with the given name, e.g. after an
+// object its labels are derived from changed. Unknown nodes are skipped.
+func (c NodeController) ReconcileNode(name string) {
+	obj, exists, err := c.store.GetByKey(name)
+	if err != nil || !exists {
+		return
+	}
+	c.handler(obj)
+}
+
+// reconcileNode labels a node once it's initialized. Uninitialized nodes and
+// nodes whose labels can't be resolved yet are added to the uninitialized
+// queue, with backoff if requeue is set.
+func (c NodeController) reconcileNode(obj interface{}, requeue bool) {
+	node, ok := nodeFromObject(obj)
 	if !ok {
 		return
 	}
-	log.Debugf("Received handler event for node %s", node.Name)
+	ctx, span := tracer.Start(context.Background(), "handler", trace.WithAttributes(
+		attribute.String("k8s.node.name", node.Name),
+		attribute.Float64("k8s.node.age_seconds", time.Since(node.CreationTimestamp.Time).Seconds()),
+	))
+	defer span.End()
+
+	// all log messages of this event carry the node fields
+	r := reconcile{id: uuid.NewString()}
+	fields := log.Fields{
+		"node":         node.Name,
+		"reconcile_id": r.id,
+	}
+	if sc := span.SpanContext(); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID().String()
+	}
+	r.logger = c.logger.WithFields(fields)
+	r.logger.Debug("Received handler event")
+	if !c.isNodeManaged(node) {
+		r.logger.Debug("Skip node because it's ignored or not selected")
+		return
+	}
+	if !c.shards.Owns(node.Name) {
+		r.logger.Debug("Skip node because its shard is owned by another replica")
+		return
+	}
 	if c.isNodeInitialized(node) {
-		c.markNode(node)
-	} else {
-		log.Warnf("Node %s was not yet initialzied by cloud controller.", node.Name)
+		if err := c.markNode(ctx, r, node); err != nil {
+			c.queueNode(r, node.Name, requeue, fmt.Sprintf("Labels of node not yet resolved (%v)", err))
+			return
+		}
+		c.uninitialized.Forget(node.Name)
+		return
+	}
+
+	c.queueNode(r, node.Name, requeue, "Node was not yet initialized")
+	if c.preLabel {
+		r.skipPrimaryRole = !c.isSpotKnown(node)
+		// the node is queued already, unresolved labels are retried with it
+		_ = c.markNode(ctx, r, node)
 	}
 }
 
-func (c NodeController) markNode(node *v1.Node) {
-	nodeCopy := common.CopyNodeObj(node)
-	nodeChanged := false
+// queueNode adds a node to the uninitialized queue, with backoff if requeue
+// is set. Events only queue nodes not yet waiting for their backoff.
+func (c NodeController) queueNode(r reconcile, name string, requeue bool, why string) {
+	switch {
+	case requeue:
+		r.logger.Warnf("%s, requeue with backoff (attempt %d)", why, c.uninitialized.NumRequeues(name)+1)
+		c.uninitialized.AddRateLimited(name)
+	case c.uninitialized.NumRequeues(name) == 0:
+		// a node with requeues is already waiting for its backoff
+		r.logger.Warnf("%s, queue it until it is", why)
+		c.uninitialized.Add(name)
+	}
+}
 
-	if c.customRoleLabel != "" {
-		customRoleLabelValue, err := c.getCustomRoleLabelValue(node)
-		if err == nil {
-			if !isAlreadyMarkedWithCustomLabel(node, customRoleLabelValue) {
-				log.Infof("Mark node %s with custom role label %s", node.Name, customRoleLabel(customRoleLabelValue))
-				addCustomRole(nodeCopy, customRoleLabelValue)
-				nodeChanged = true
-			}
-		} else {
-			log.Debugf("Node %s doesn't have custom label: %s", node.Name, c.customRoleLabel)
-		}
+// markNode applies the desired labels to node. It returns an error if some
+// of them couldn't be resolved yet, the node has to be marked again later.
+func (c NodeController) markNode(ctx context.Context, r reconcile, node *v1.Node) error {
+	ctx, span := tracer.Start(ctx, "markNode")
+	defer span.End()
+
+	nodeCopy, changes, unresolved := c.desiredNode(ctx, r, node, c.lazySpotInstance(ctx, r.logger, node))
+	if len(changes) == 0 {
+		r.logger.Debug("Skip node because it's already marked")
+		return unresolved
 	}
 
-	if c.isWorkerNode(node) && !isAlreadyMarkedWorkerNode(node) {
-		log.Infof("Mark worker node %s", node.Name)
-		addWorkerLabels(nodeCopy, c.spotInstanceDiscovery.IsSpotInstance(node))
-		nodeChanged = true
-	} else if c.isControlPlaneNode(node) {
-		if !isAlreadyMarkedControlPlane(node) || (c.controlPlaneLegacyLabel && !isAlreadyMarkedMaster(node)) {
-			log.Infof("Mark master node %s", node.Name)
-			addControlPlaneLabels(nodeCopy, c.includeAlphaLabel, c.excludeLoadBalancing, c.excludeEviction, c.spotInstanceDiscovery.IsSpotInstance(node), c.controlPlaneLegacyLabel)
-			nodeChanged = true
+	added, removed := labelChanges(node, nodeCopy)
+	logger := r.logger.WithFields(log.Fields{
+		"labels_added":   added,
+		"labels_removed": removed,
+	})
+	if err := c.updateNode(ctx, node, nodeCopy); err != nil {
+		logger.Errorf("Failed to mark node with error: %v", err)
+		return unresolved
+	}
+	logger.Info("Marked node")
+
+	if c.auditSink != nil {
+		before, after := audit.Diff(node.Labels, nodeCopy.Labels)
+		err := c.auditSink.Write(audit.Record{
+			Time:        time.Now(),
+			Node:        node.Name,
+			Identity:    c.identity,
+			ReconcileID: r.id,
+			Reasons:     changes.messages(),
+			Before:      before,
+			After:       after,
+		})
+		if err != nil {
+			logger.Errorf("Failed to write audit record: %v", err)
 		}
 	}
+	return unresolved
+}
 
-	if c.karpenterEnabled && isNodeManagedByKarpenter(node) && !isAlreadyMarkedKarpenterNode(node) {
-		log.Infof("Mark node %s with karpenter role label %s", node.Name, NodeKarpenterLabel)
-		addKarpenterLabel(nodeCopy)
-		nodeChanged = true
+// labelChanges returns the labels nodeCopy adds or changes and the keys it removes compared to node.
+func labelChanges(node *v1.Node, nodeCopy *v1.Node) (map[string]string, []string) {
+	added := make(map[string]string)
+	for k, v := range nodeCopy.Labels {
+		if old, ok := node.Labels[k]; !ok || old != v {
+			added[k] = v
+		}
 	}
-
-	if nodeChanged {
-		_, err := c.client.CoreV1().Nodes().Update(context.TODO(), nodeCopy, metav1.UpdateOptions{})
-		if err != nil {
-			log.Errorf("Failed to mark node %s with error: %v", node.Name, err)
+	removed := []string{}
+	for k := range node.Labels {
+		if _, ok := nodeCopy.Labels[k]; !ok {
+			removed = append(removed, k)
 		}
-	} else {
-		log.Debugf("Skip node %s because it's already marked", node.Name)
 	}
+	sort.Strings(removed)
+	return added, removed
+}
+
+// reason explains a change of a node and the label keys it touched.
+type reason struct {
+	message string
+	labels  []string
 }
 
-func (c NodeController) getCustomRoleLabelValue(node *v1.Node) (string, error) {
-	if node.Labels != nil {
-		if label, ok := node.Labels[c.customRoleLabel]; ok {
-			return label, nil
+// reasons collects why a node changes.
+type reasons []reason
+
+// add appends a reason for a change not touching labels.
+func (r *reasons) add(format string, args ...interface{}) {
+	*r = append(*r, reason{message: fmt.Sprintf(format, args...)})
+}
+
+// apply runs change on nodeCopy and appends a reason for the label keys it
+// touched. Nothing is appended if the labels didn't change.
+func (r *reasons) apply(nodeCopy *v1.Node, change func(), format string, args ...interface{}) {
+	before := maps.Clone(nodeCopy.Labels)
+	change()
+
+	var keys []string
+	for k, v := range nodeCopy.Labels {
+		if old, ok := before[k]; !ok || old != v {
+			keys = append(keys, k)
 		}
 	}
+	for k := range before {
+		if _, ok := nodeCopy.Labels[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+	*r = append(*r, reason{message: fmt.Sprintf(format, args...), labels: keys})
+}
 
-	return "", fmt.Errorf("Node %s doesn't have %s label", node.Name, c.customRoleLabel)
+// without returns the reasons left after the label keys in dropped were reverted.
+func (r reasons) without(dropped []string) reasons {
+	var left reasons
+	for _, reason := range r {
+		if len(reason.labels) == 0 || slices.ContainsFunc(reason.labels, func(k string) bool { return !slices.Contains(dropped, k) }) {
+			left = append(left, reason)
+		}
+	}
+	return left
 }
 
-func addCustomRole(node *v1.Node, role string) {
-	node.Labels[customRoleLabel(role)] = ""
+// log logs every reason.
+func (r reasons) log(logger log.FieldLogger) {
+	for _, reason := range r {
+		logger.Info(reason.message)
+	}
 }
 
-func addWorkerLabels(node *v1.Node, isSpot bool) {
-	if isSpot {
-		node.Labels[NodeRoleSpotWorkerLabel] = ""
-	} else {
-		node.Labels[NodeRoleWorkerLabel] = ""
+func (r reasons) messages() []string {
+	messages := make([]string, 0, len(r))
+	for _, reason := range r {
+		messages = append(messages, reason.message)
 	}
+	return messages
 }
 
-func addControlPlaneLabels(node *v1.Node, includeAlphaLabel bool, excludeLoadBalancing bool, excludeEviction bool, isSpot bool, useLegacyMasterLabel bool) {
-	if isSpot {
-		if useLegacyMasterLabel {
-			node.Labels[NodeRoleSpotMasterLabel] = ""
+// desiredNode returns a copy of node carrying all labels the controller wants
+// it to have, and the reasons of its changes. No reasons are returned if the
+// node doesn't change. Reasons are logged once invalid labels are dropped.
+// isSpot is only called if the role labels depend on it. The returned error
+// lists what couldn't be resolved yet, e.g. a failed spot lookup, the
+// startup taint is kept until it is.
+func (c NodeController) desiredNode(ctx context.Context, r reconcile, node *v1.Node, isSpot func() (bool, error)) (*v1.Node, reasons, error) {
+	nodeCopy := common.CopyNodeObj(node)
+	var changes reasons
+	var unresolved []error
+
+	var customRoleLabelValues []string
+	if len(c.customRoleSources) > 0 {
+		values, err := c.getCustomRoleLabelValue(r.logger, node)
+		if err == nil {
+			customRoleLabelValues = values
+		} else {
+			r.logger.Debugf("Node doesn't have custom label: %s", customRoleSourceLabels(c.customRoleSources))
+		}
+	}
+	isKarpenterNode := c.isKarpenterNode(node)
+	sources := c.roleSources(node)
+
+	if r.skipPrimaryRole {
+		r.logger.Debug("Skip primary role until the spot provider can answer")
+	} else if len(c.rolePrecedence) > 0 {
+		roles := withRoles(customRoleLabelValues, sourceRoles(sources)...)
+		primaryChanges, err := c.markPrimaryRole(node, nodeCopy, c.primaryRole(node, roles, isKarpenterNode), isSpot)
+		if err != nil {
+			unresolved = append(unresolved, err)
+		}
+		changes = append(changes, primaryChanges...)
+	} else if c.isWorkerNode(node) && !isAlreadyMarkedWorkerNode(node, c.roleLabels) {
+		if spot, err := isSpot(); err != nil {
+			unresolved = append(unresolved, err)
+		} else {
+			changes.apply(nodeCopy, func() { addWorkerLabels(nodeCopy, c.roleLabels, spot) }, "Mark worker node")
+		}
+	} else if c.isControlPlaneNode(node) {
+		if !isAlreadyMarkedControlPlane(node, c.roleLabels) || (c.controlPlaneLegacyLabel && !isAlreadyMarkedMaster(node, c.roleLabels)) {
+			if spot, err := isSpot(); err != nil {
+				unresolved = append(unresolved, err)
+			} else {
+				changes.apply(nodeCopy, func() {
+					addControlPlaneLabels(nodeCopy, c.roleLabels, c.includeAlphaLabel, c.excludeLoadBalancing, c.excludeEviction, spot, c.controlPlaneLegacyLabel)
+				}, "Mark master node")
+			}
 		}
-		node.Labels[NodeRoleSpotControlPlaneLabel] = ""
+	}
+	if c.isMachinePending(node) {
+		unresolved = append(unresolved, errors.New("no Machine cached for the node yet"))
+	}
+	if c.isNodeClaimPending(node) {
+		unresolved = append(unresolved, errors.New("no NodeClaim cached for the node yet"))
+	}
 
-	} else {
-		if useLegacyMasterLabel {
-			node.Labels[NodeRoleMasterLabel] = ""
+	for _, customRoleLabelValue := range customRoleLabelValues {
+		if !c.isExclusiveRole(customRoleLabelValue) && !isAlreadyMarkedWithCustomLabel(node, c.roleLabels, customRoleLabelValue) {
+			changes.apply(nodeCopy, func() { addCustomRole(nodeCopy, c.roleLabels, customRoleLabelValue) },
+				"Mark node with custom role label %s", c.roleLabels.prefixed(customRoleLabelValue))
 		}
-		node.Labels[NodeRoleControlPlaneLabel] = ""
 	}
 
-	if excludeEviction == true {
-		node.Labels[ExcludeDisruptionLabel] = "true"
+	if isKarpenterNode && !c.isExclusiveRole(RoleKarpenter) && !isAlreadyMarkedKarpenterNode(node, c.roleLabels) {
+		changes.apply(nodeCopy, func() { addKarpenterLabel(nodeCopy, c.roleLabels) },
+			"Mark node with karpenter role label %s", c.roleLabels.prefixed(RoleKarpenter))
 	}
 
-	if excludeLoadBalancing == true {
-		node.Labels[ExcludeLoadBalancerLabel] = "true"
+	for _, source := range sources {
+		if source.role != "" && !c.isExclusiveRole(source.role) && !hasLabels(node, c.roleLabels.secondary(source.role)) {
+			changes.apply(nodeCopy, func() { addLabels(nodeCopy, c.roleLabels.secondary(source.role)) },
+				"Mark node with %s role label %s", source.name, c.roleLabels.prefixed(source.role))
+		}
+	}
 
-		if includeAlphaLabel == true {
-			node.Labels[AlphaExcludeLoadBalancerLabel] = "true"
+	for _, t := range c.labelTemplates {
+		key, value, ok, err := t.Render(node)
+		if err != nil {
+			r.logger.Warnf("Skip label template %s: %v", t, err)
+			continue
+		}
+		if !ok {
+			r.logger.Debugf("Label template %s rendered nothing", t)
+			continue
+		}
+		if current, exists := node.Labels[key]; !exists || current != value {
+			changes.apply(nodeCopy, func() { nodeCopy.Labels[key] = value }, "Mark node with templated label %s=%s", key, value)
 		}
 	}
-}
 
-// Deprecated. Will be removed in future release
-func isAlreadyMarkedMaster(node *v1.Node) bool {
-	if node.Labels != nil {
-		if _, ok := node.Labels[NodeRoleMasterLabel]; ok {
-			return true
+	for _, l := range c.conditionLabels {
+		current, exists := node.Labels[l.Key]
+		if l.met(node) {
+			if !exists || current != l.Value {
+				changes.apply(nodeCopy, func() { nodeCopy.Labels[l.Key] = l.Value }, "Mark node with condition label %s", l)
+			}
+		} else if exists {
+			changes.apply(nodeCopy, func() { delete(nodeCopy.Labels, l.Key) }, "Remove condition label %s because its conditions aren't met", l)
 		}
+	}
 
-		if _, ok := node.Labels[NodeRoleSpotMasterLabel]; ok {
-			return true
+	if len(changes) > 0 {
+		changes = changes.without(c.dropInvalidLabels(r.logger, node, nodeCopy))
+		if maps.Equal(node.Labels, nodeCopy.Labels) {
+			r.logger.Debug("Skip node because no valid label changes are left")
+			changes = nil
+		}
+	}
+
+	// removed within the same update as the labels, so the node never becomes schedulable without them
+	err := errors.Join(unresolved...)
+	if c.startupTaint != "" && c.isNodeInitialized(node) {
+		if err != nil {
+			r.logger.Debugf("Keep startup taint %s until all labels are resolved", c.startupTaint)
+		} else if removeTaint(nodeCopy, c.startupTaint) {
+			changes.add("Remove startup taint %s after labeling", c.startupTaint)
 		}
 	}
 
-	return false
+	changes.log(r.logger)
+	return nodeCopy, changes, err
 }
 
-func isAlreadyMarkedControlPlane(node *v1.Node) bool {
-	if node.Labels != nil {
-		if _, ok := node.Labels[NodeRoleControlPlaneLabel]; ok {
-			return true
+// getCustomRoleLabelValue returns the roles of all custom role sources
+// present on the node, resolved according to the conflict policy.
+func (c NodeController) getCustomRoleLabelValue(logger log.FieldLogger, node *v1.Node) ([]string, error) {
+	var sourceRoles [][]string
+	for _, source := range c.customRoleSources {
+		if label, ok := node.Labels[source.Label]; ok {
+			sourceRoles = append(sourceRoles, c.splitCustomRoles(logger, node, source, label))
 		}
+	}
+
+	if len(sourceRoles) == 0 {
+		return nil, fmt.Errorf("Node %s doesn't have %s label", node.Name, customRoleSourceLabels(c.customRoleSources))
+	}
 
-		if _, ok := node.Labels[NodeRoleSpotControlPlaneLabel]; ok {
-			return true
+	var roles []string
+	for _, r := range sourceRoles {
+		for _, role := range r {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
 		}
 	}
 
-	return false
+	if len(sourceRoles) > 1 {
+		switch c.customRolePolicy {
+		case CustomRoleConflictFirst:
+			return sourceRoles[0], nil
+		case CustomRoleConflictSkip:
+			for _, r := range sourceRoles {
+				if len(r) != len(roles) {
+					logger.Warnf("Skip custom roles because sources disagree: %v", roles)
+					return nil, nil
+				}
+			}
+		}
+	}
+
+	return roles, nil
 }
 
-func isAlreadyMarkedWorkerNode(node *v1.Node) bool {
-	if node.Labels != nil {
-		if _, ok := node.Labels[NodeRoleWorkerLabel]; ok {
-			return true
-		}
+// splitCustomRoles splits a custom role label value at the configured
+// delimiter and drops roles that don't result in a valid label key.
+func (c NodeController) splitCustomRoles(logger log.FieldLogger, node *v1.Node, source CustomRoleSource, label string) []string {
+	values := []string{label}
+	if c.customRoleDelimiter != "" {
+		values = strings.Split(label, c.customRoleDelimiter)
+	}
 
-		if _, ok := node.Labels[NodeRoleSpotWorkerLabel]; ok {
-			return true
+	var roles []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		role := source.role(value)
+		if errs := validation.IsQualifiedName(c.roleLabels.prefixed(role)); len(errs) > 0 {
+			logger.Warnf("Skip invalid custom role %q from label %s: %s", role, source.Label, strings.Join(errs, "; "))
+			c.recorder.Eventf(node, v1.EventTypeWarning, EventReasonInvalidCustomRole, "Skip invalid custom role %q from label %s: %s", role, source.Label, strings.Join(errs, "; "))
+			continue
+		}
+		if !slices.Contains(roles, role) {
+			roles = append(roles, role)
 		}
 	}
+	return roles
+}
 
-	return false
+func addCustomRole(node *v1.Node, roles RoleLabels, role string) {
+	addLabels(node, roles.secondary(role))
 }
 
-func isAlreadyMarkedWithCustomLabel(node *v1.Node, customRoleLabelValue string) bool {
-	if node.Labels != nil {
-		if _, ok := node.Labels[customRoleLabel(customRoleLabelValue)]; ok {
-			return true
-		}
+func addWorkerLabels(node *v1.Node, roles RoleLabels, isSpot bool) {
+	if isSpot {
+		addLabels(node, roles.primary(RoleSpotWorker))
+	} else {
+		addLabels(node, roles.primary(RoleWorker))
 	}
-	return false
 }
 
-func (c NodeController) isControlPlaneNode(node *v1.Node) bool {
-	for _, t := range node.Spec.Taints {
-		if t.Key == c.controlPlaneTaint {
-			return true
+func addControlPlaneLabels(node *v1.Node, roles RoleLabels, includeAlphaLabel bool, excludeLoadBalancing bool, excludeEviction bool, isSpot bool, useLegacyMasterLabel bool) {
+	if isSpot {
+		if useLegacyMasterLabel {
+			addLabels(node, roles.secondary(RoleSpotMaster))
 		}
+		addLabels(node, roles.primary(RoleSpotControlPlane))
+
+	} else {
+		if useLegacyMasterLabel {
+			addLabels(node, roles.secondary(RoleMaster))
+		}
+		addLabels(node, roles.primary(RoleControlPlane))
 	}
 
-	return false
+	if excludeEviction == true {
+		node.Labels[ExcludeDisruptionLabel] = "true"
+	}
+
+	if excludeLoadBalancing == true {
+		node.Labels[ExcludeLoadBalancerLabel] = "true"
+
+		if includeAlphaLabel == true {
+			node.Labels[AlphaExcludeLoadBalancerLabel] = "true"
+		}
+	}
 }
 
-func (c NodeController) isWorkerNode(node *v1.Node) bool {
-	return !c.isControlPlaneNode(node)
+// Deprecated. Will be removed in future release
+func isAlreadyMarkedMaster(node *v1.Node, roles RoleLabels) bool {
+	return hasLabels(node, roles.secondary(RoleMaster)) || hasLabels(node, roles.secondary(RoleSpotMaster))
 }
 
-func customRoleLabel(role string) string {
-	return fmt.Sprintf("node-role.kubernetes.io/%s", role)
+func isAlreadyMarkedControlPlane(node *v1.Node, roles RoleLabels) bool {
+	return hasLabels(node, roles.primary(RoleControlPlane)) || hasLabels(node, roles.primary(RoleSpotControlPlane))
 }
 
-func (c NodeController) isNodeInitialized(node *v1.Node) bool {
-	for i := range node.Spec.Taints {
-		if node.Spec.Taints[i].Key == NodeUninitialziedTaint {
-			return false
-		}
-	}
-	return true
+func isAlreadyMarkedWorkerNode(node *v1.Node, roles RoleLabels) bool {
+	return hasLabels(node, roles.primary(RoleWorker)) || hasLabels(node, roles.primary(RoleSpotWorker))
+}
+
+func isAlreadyMarkedWithCustomLabel(node *v1.Node, roles RoleLabels, customRoleLabelValue string) bool {
+	return hasLabels(node, roles.secondary(customRoleLabelValue))
 }
 
-func isNodeManagedByKarpenter(node *v1.Node) bool {
-	if node.Labels == nil {
-		return false
+// isSpotInstance asks the spot provider about node within a trace span. It
+// returns an error if the provider can't tell yet.
+func (c NodeController) isSpotInstance(ctx context.Context, logger log.FieldLogger, node *v1.Node) (bool, error) {
+	if isSpot, source, ok := c.labeledSpot(node); ok {
+		logger.Debugf("Use %s instead of the spot provider", source)
+		return isSpot, nil
+	}
+
+	_, span := tracer.Start(ctx, "spotdiscovery.IsSpotInstance", trace.WithAttributes(
+		attribute.String("k8s.node.name", node.Name),
+		attribute.String("spot.provider", fmt.Sprintf("%T", c.spotInstanceDiscovery)),
+	))
+	defer span.End()
+
+	isSpot, err := c.spotInstanceDiscovery.IsSpotInstance(logger, node)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
 	}
-	_, ok := node.Labels[NodeKarpenterManagedLabelKey]
+	span.SetAttributes(attribute.Bool("spot.instance", isSpot))
+	return isSpot, nil
+}
 
-	return ok
+// lazySpotInstance returns a function calling isSpotInstance on its first call
+// only, so the spot provider is asked at most once per evaluation of a node.
+func (c NodeController) lazySpotInstance(ctx context.Context, logger log.FieldLogger, node *v1.Node) func() (bool, error) {
+	return sync.OnceValues(func() (bool, error) {
+		return c.isSpotInstance(ctx, logger, node)
+	})
 }
 
-func addKarpenterLabel(node *v1.Node) {
-	node.Labels[NodeKarpenterLabel] = ""
+func (c NodeController) isControlPlaneNode(node *v1.Node) bool {
+	return c.controlPlaneDetector.IsControlPlane(node)
 }
 
-func isAlreadyMarkedKarpenterNode(node *v1.Node) bool {
-	if node.Labels == nil {
-		return false
-	}
+func (c NodeController) isWorkerNode(node *v1.Node) bool {
+	return !c.isControlPlaneNode(node)
+}
+
+func addKarpenterLabel(node *v1.Node, roles RoleLabels) {
+	addLabels(node, roles.secondary(RoleKarpenter))
+}
 
-	_, ok := node.Labels[NodeKarpenterLabel]
-	return ok
+func isAlreadyMarkedKarpenterNode(node *v1.Node, roles RoleLabels) bool {
+	return hasLabels(node, roles.secondary(RoleKarpenter))
 }
@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/daspawnw/k8s-node-label/pkg/audit"
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -137,7 +142,7 @@ func TestHandlerShouldSetNodeRoleMasterAndControlPlaneForMaster(t *testing.T) {
 	clientset := fake.NewSimpleClientset(MasterNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleMasterLabel, true, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleMasterLabel), ControlPlaneLegacyLabel: true})
 	c.handler(MasterNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-master-node", metav1.GetOptions{})
@@ -153,7 +158,7 @@ func TestHandlerShouldSetSpotMasterRoleAndControlPlaneForMaster(t *testing.T) {
 	clientset := fake.NewSimpleClientset(SoptMasterNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleMasterLabel, true, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleMasterLabel), ControlPlaneLegacyLabel: true})
 	c.handler(SoptMasterNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-spot-master", metav1.GetOptions{})
@@ -169,7 +174,7 @@ func TestHandlerShouldSetNodeRoleMasterAndControlPlaneForControlPlane(t *testing
 	clientset := fake.NewSimpleClientset(ControlPlaneNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, true, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), ControlPlaneLegacyLabel: true})
 	c.handler(ControlPlaneNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-control-plane-node", metav1.GetOptions{})
@@ -185,7 +190,7 @@ func TestHandlerShouldSetSpotMasterRoleAndControlPlaneForControlPlane(t *testing
 	clientset := fake.NewSimpleClientset(SoptControlPlaneNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, true, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), ControlPlaneLegacyLabel: true})
 	c.handler(SoptControlPlaneNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-spot-control-plane-node", metav1.GetOptions{})
@@ -201,7 +206,7 @@ func TestHandlerShouldSetNodeRoleControlPlane(t *testing.T) {
 	clientset := fake.NewSimpleClientset(ControlPlaneNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
 	c.handler(ControlPlaneNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-control-plane-node", metav1.GetOptions{})
@@ -217,7 +222,7 @@ func TestHandlerShouldSetSpotControlPlane(t *testing.T) {
 	clientset := fake.NewSimpleClientset(SoptControlPlaneNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
 	c.handler(SoptControlPlaneNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-spot-control-plane-node", metav1.GetOptions{})
@@ -233,7 +238,7 @@ func TestHandlerShouldSetWorkerRoleIfWorker(t *testing.T) {
 	clientset := fake.NewSimpleClientset(WorkerNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
 	c.handler(WorkerNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-worker-node", metav1.GetOptions{})
@@ -249,7 +254,7 @@ func TestHandlerShouldSetSpotWorkerRoleIfSpotWorker(t *testing.T) {
 	clientset := fake.NewSimpleClientset(SpotWorkerNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
 	c.handler(SpotWorkerNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-spot-node", metav1.GetOptions{})
@@ -268,7 +273,7 @@ func TestHandlerShouldSetWorkerRoleIfNotSet(t *testing.T) {
 	clientset := fake.NewSimpleClientset(UnManagedNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
 	c.handler(UnManagedNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-unmanaged-node", metav1.GetOptions{})
@@ -281,7 +286,7 @@ func TestHandlerShouldPreventMasterFromLoadbalancing(t *testing.T) {
 	clientset := fake.NewSimpleClientset(MasterNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, true, true, false, NodeRoleMasterLabel, true, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ExcludeLoadBalancing: true, IncludeAlphaLabel: true, ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleMasterLabel), ControlPlaneLegacyLabel: true})
 	c.handler(MasterNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-master-node", metav1.GetOptions{})
@@ -306,7 +311,7 @@ func TestHandlerShouldPreventControlPlaneFromLoadbalancing(t *testing.T) {
 	clientset := fake.NewSimpleClientset(ControlPlaneNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, true, true, false, NodeRoleControlPlaneLabel, false, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ExcludeLoadBalancing: true, IncludeAlphaLabel: true, ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
 	c.handler(ControlPlaneNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-control-plane-node", metav1.GetOptions{})
@@ -331,7 +336,7 @@ func TestHandlerShouldExcludeNodeFromEviction(t *testing.T) {
 	clientset := fake.NewSimpleClientset(ControlPlaneNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, true, NodeRoleControlPlaneLabel, false, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ExcludeEviction: true, ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
 	c.handler(ControlPlaneNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-control-plane-node", metav1.GetOptions{})
@@ -346,11 +351,11 @@ func TestHandlerShouldExcludeNodeFromEviction(t *testing.T) {
 
 type TestingMockDiscovery struct{}
 
-func (TestingMockDiscovery) IsSpotInstance(node *v1.Node) bool {
+func (TestingMockDiscovery) IsSpotInstance(logger log.FieldLogger, node *v1.Node) (bool, error) {
 	if node.Spec.ProviderID != "" && (node.Spec.ProviderID == "aws:///eu-central-1/i-123uzu123" || node.Spec.ProviderID == "aws:///eu-central-1/i-123asd132") {
-		return true
+		return true, nil
 	}
-	return false
+	return false, nil
 }
 
 // Test customRoleLabelValue
@@ -358,10 +363,10 @@ func TestCustomRoleLabelFound(t *testing.T) {
 	clientset := fake.NewSimpleClientset(ControlPlaneNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 	customRoleLabel := "customLabel"
-	expectedRole := "customRole"
+	expectedRole := []string{"customRole"}
 	var expectedErr error = nil
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, true, NodeRoleControlPlaneLabel, false, customRoleLabel, false)
-	role, err := c.getCustomRoleLabelValue(WorkerNodeWithCustomLabel)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ExcludeEviction: true, ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), CustomRoleSources: []CustomRoleSource{{Label: customRoleLabel}}})
+	role, err := c.getCustomRoleLabelValue(c.logger, WorkerNodeWithCustomLabel)
 
 	assert.Equalf(t, expectedRole, role, "Role %s is not equal to %s", role, expectedRole)
 	assert.Equalf(t, expectedErr, err, "Error %s is not equal to %s", err, expectedRole)
@@ -371,10 +376,10 @@ func TestCustomRoleLabelNotFound(t *testing.T) {
 	clientset := fake.NewSimpleClientset(ControlPlaneNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 	customRoleLabel := "customLabel"
-	expectedRole := ""
+	var expectedRole []string
 	expectedErr := fmt.Errorf("Node %s doesn't have %s label", WorkerNode.Name, customRoleLabel)
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, true, NodeRoleControlPlaneLabel, false, customRoleLabel, false)
-	role, err := c.getCustomRoleLabelValue(WorkerNode)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ExcludeEviction: true, ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), CustomRoleSources: []CustomRoleSource{{Label: customRoleLabel}}})
+	role, err := c.getCustomRoleLabelValue(c.logger, WorkerNode)
 
 	assert.Equalf(t, expectedRole, role, "Role %s is not equal to %s", role, expectedRole)
 	assert.Equalf(t, expectedErr, err, "Error %s is not equal to %s", err, expectedRole)
@@ -386,7 +391,7 @@ func TestHandlerShouldSetCustomRoleIfLabelPresent(t *testing.T) {
 	clientset := fake.NewSimpleClientset(WorkerNodeWithCustomLabel)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "customLabel", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), CustomRoleSources: []CustomRoleSource{{Label: "customLabel"}}})
 	c.handler(WorkerNodeWithCustomLabel)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-worker-node-with-label", metav1.GetOptions{})
@@ -399,7 +404,7 @@ func TestHandlerShouldNotSetCustomRoleIfLabelNotPresent(t *testing.T) {
 	clientset := fake.NewSimpleClientset(WorkerNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "customLabel", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), CustomRoleSources: []CustomRoleSource{{Label: "customLabel"}}})
 	c.handler(WorkerNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-worker-node", metav1.GetOptions{})
@@ -430,7 +435,7 @@ func TestIsNodeInitializedTrue(t *testing.T) {
 	}
 	clientset := fake.NewSimpleClientset(initializedNode)
 	testingMockDiscovery := TestingMockDiscovery{}
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
 
 	result := c.isNodeInitialized(initializedNode)
 	expected := true
@@ -443,7 +448,7 @@ func TestIsNodeInitializedFalse(t *testing.T) {
 
 	clientset := fake.NewSimpleClientset(UninitializedNode)
 	testingMockDiscovery := TestingMockDiscovery{}
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
 
 	result := c.isNodeInitialized(UninitializedNode)
 	expected := false
@@ -456,7 +461,7 @@ func TestHandlerShouldNotSetLabelIfNodeUninitialized(t *testing.T) {
 	clientset := fake.NewSimpleClientset(UninitializedNode)
 	testingMockDiscovery := TestingMockDiscovery{}
 
-	c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "", false)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
 	c.handler(UninitializedNode)
 
 	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), "test-uninitialized-control-plane-node", metav1.GetOptions{})
@@ -515,7 +520,7 @@ func TestKubernetesNodeLabeling(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			clientset := fake.NewSimpleClientset(tc.node)
 			testingMockDiscovery := TestingMockDiscovery{}
-			c := NewNodeController(clientset, testingMockDiscovery, false, false, false, NodeRoleControlPlaneLabel, false, "", tc.karpenterEnabled)
+			c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), KarpenterEnabled: tc.karpenterEnabled})
 			c.handler(tc.node)
 
 			foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), tc.node.Name, metav1.GetOptions{})
@@ -523,3 +528,95 @@ func TestKubernetesNodeLabeling(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlerShouldLogStructuredFields(t *testing.T) {
+	clientset := fake.NewSimpleClientset(WorkerNode)
+	logger, hook := logtest.NewNullLogger()
+
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{})
+	c.logger = logger
+	c.handler(WorkerNode)
+
+	entry := hook.LastEntry()
+	assert.Equal(t, "Marked node", entry.Message)
+	assert.Equal(t, WorkerNode.Name, entry.Data["node"])
+	assert.NotEmpty(t, entry.Data["reconcile_id"])
+	assert.Equal(t, map[string]string{NodeRoleWorkerLabel: ""}, entry.Data["labels_added"])
+	assert.Equal(t, []string{}, entry.Data["labels_removed"])
+}
+
+type testingAuditSink struct {
+	records *[]audit.Record
+}
+
+func (s testingAuditSink) Write(record audit.Record) error {
+	*s.records = append(*s.records, record)
+	return nil
+}
+
+func TestHandlerShouldWriteAuditRecords(t *testing.T) {
+	clientset := fake.NewSimpleClientset(SpotWorkerNode)
+	var records []audit.Record
+
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{AuditSink: testingAuditSink{records: &records}, Identity: "replica-a"})
+	c.handler(SpotWorkerNode)
+
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), SpotWorkerNode.Name, metav1.GetOptions{})
+	c.handler(foundNode)
+
+	assert.Len(t, records, 1)
+	assert.Equal(t, SpotWorkerNode.Name, records[0].Node)
+	assert.Equal(t, "replica-a", records[0].Identity)
+	assert.NotEmpty(t, records[0].ReconcileID)
+	assert.Equal(t, []string{"Mark worker node"}, records[0].Reasons)
+	assert.Empty(t, records[0].Before)
+	assert.Equal(t, map[string]string{NodeRoleSpotWorkerLabel: ""}, records[0].After)
+}
+
+func TestHandlerShouldOnlyAuditChangedLabels(t *testing.T) {
+	node := SpotWorkerNode.DeepCopy()
+	node.Labels = map[string]string{"kubernetes.io/os": "linux"}
+	clientset := fake.NewSimpleClientset(node)
+	var records []audit.Record
+
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{AuditSink: testingAuditSink{records: &records}})
+	c.handler(node)
+
+	assert.Len(t, records, 1)
+	assert.Empty(t, records[0].Before)
+	assert.Equal(t, map[string]string{NodeRoleSpotWorkerLabel: ""}, records[0].After)
+}
+
+func TestMirrorPodShouldRelabelNodeLabeledBefore(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "kind-control-plane"}}
+	clientset := fake.NewSimpleClientset(node)
+	detector := controlplane.NewMirrorPodDetector(clientset)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{ControlPlaneDetector: detector})
+	detector.OnNodeChange(c.ReconcileNode)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	detector.Run(stopCh)
+
+	c.handler(node)
+	labeled, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Contains(t, labeled.Labels, NodeRoleWorkerLabel)
+	c.store.Add(labeled)
+
+	// the kubelet creates the mirror pod only after the node registered
+	_, err := clientset.CoreV1().Pods(controlplane.APIServerPodNamespace).Create(context.TODO(), &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "kube-apiserver-kind-control-plane",
+			Namespace:   controlplane.APIServerPodNamespace,
+			Labels:      map[string]string{"component": "kube-apiserver"},
+			Annotations: map[string]string{controlplane.MirrorPodAnnotation: "abc"},
+		},
+		Spec: v1.PodSpec{NodeName: node.Name},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+		_, ok := foundNode.Labels[NodeRoleControlPlaneLabel]
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CustomRoleSource describes a node label whose value is turned into a
+// node-role.kubernetes.io/<value> label.
+type CustomRoleSource struct {
+	Label string
+	// TrimPrefix is stripped from the label value, e.g. "ng-" for node groups named "ng-gpu".
+	TrimPrefix string
+	// ValueMap translates label values into role names. Mapped values are not prefix stripped.
+	ValueMap map[string]string
+}
+
+// CustomRoleConflictPolicy decides what happens when several custom role
+// sources are present on a node and resolve to different roles.
+type CustomRoleConflictPolicy string
+
+const (
+	// CustomRoleConflictAll adds a role label for every source.
+	CustomRoleConflictAll CustomRoleConflictPolicy = "all"
+	// CustomRoleConflictFirst only uses the first source present on the node.
+	CustomRoleConflictFirst CustomRoleConflictPolicy = "first"
+	// CustomRoleConflictSkip adds no custom role at all if the sources disagree.
+	CustomRoleConflictSkip CustomRoleConflictPolicy = "skip"
+)
+
+// ParseCustomRoleSource parses a source in the form
+// LABEL[,trim-prefix=PREFIX][,map=FROM:TO;FROM:TO].
+func ParseCustomRoleSource(spec string) (CustomRoleSource, error) {
+	parts := strings.Split(spec, ",")
+	source := CustomRoleSource{
+		Label: strings.TrimSpace(parts[0]),
+	}
+	if source.Label == "" {
+		return CustomRoleSource{}, fmt.Errorf("custom role source %q has an empty label", spec)
+	}
+
+	for _, option := range parts[1:] {
+		name, value, found := strings.Cut(option, "=")
+		if !found {
+			return CustomRoleSource{}, fmt.Errorf("custom role source %q has an invalid option %q", spec, option)
+		}
+		switch strings.TrimSpace(name) {
+		case "trim-prefix":
+			source.TrimPrefix = value
+		case "map":
+			source.ValueMap = make(map[string]string)
+			for _, mapping := range strings.Split(value, ";") {
+				from, to, found := strings.Cut(mapping, ":")
+				if !found || from == "" || to == "" {
+					return CustomRoleSource{}, fmt.Errorf("custom role source %q has an invalid mapping %q", spec, mapping)
+				}
+				source.ValueMap[from] = to
+			}
+		default:
+			return CustomRoleSource{}, fmt.Errorf("custom role source %q has an unknown option %q", spec, name)
+		}
+	}
+
+	return source, nil
+}
+
+// ParseCustomRoleConflictPolicy validates the name of a conflict policy.
+func ParseCustomRoleConflictPolicy(policy string) (CustomRoleConflictPolicy, error) {
+	switch p := CustomRoleConflictPolicy(policy); p {
+	case CustomRoleConflictAll, CustomRoleConflictFirst, CustomRoleConflictSkip:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown custom role conflict policy %q, available values: (all, first, skip)", policy)
+}
+
+// role returns the role name for a label value of this source.
+func (s CustomRoleSource) role(value string) string {
+	if mapped, ok := s.ValueMap[value]; ok {
+		return mapped
+	}
+	return strings.TrimPrefix(value, s.TrimPrefix)
+}
+
+func customRoleSourceLabels(sources []CustomRoleSource) string {
+	labels := make([]string, 0, len(sources))
+	for _, s := range sources {
+		labels = append(labels, s.Label)
+	}
+	return strings.Join(labels, ", ")
+}
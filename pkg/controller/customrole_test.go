@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+var MultiSourceWorkerNode = &v1.Node{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "test-multi-source-node",
+		Labels: map[string]string{
+			"eks.amazonaws.com/nodegroup": "ng-gpu",
+			"team":                        "ml",
+		},
+	},
+	Spec: v1.NodeSpec{
+		ProviderID: "aws:///eu-central-1/i-123qwe123",
+	},
+}
+
+func TestParseCustomRoleSource(t *testing.T) {
+	source, err := ParseCustomRoleSource("eks.amazonaws.com/nodegroup,trim-prefix=ng-,map=ng-default:worker;ng-ci:build")
+	assert.NoError(t, err)
+	assert.Equal(t, CustomRoleSource{
+		Label:      "eks.amazonaws.com/nodegroup",
+		TrimPrefix: "ng-",
+		ValueMap: map[string]string{
+			"ng-default": "worker",
+			"ng-ci":      "build",
+		},
+	}, source)
+
+	assert.Equal(t, "gpu", source.role("ng-gpu"))
+	assert.Equal(t, "build", source.role("ng-ci"))
+
+	for _, spec := range []string{"", ",trim-prefix=ng-", "team,prefix", "team,map=a", "team,unknown=x"} {
+		_, err := ParseCustomRoleSource(spec)
+		assert.Errorf(t, err, "Expected error for spec %q", spec)
+	}
+}
+
+func TestParseCustomRoleConflictPolicy(t *testing.T) {
+	policy, err := ParseCustomRoleConflictPolicy("first")
+	assert.NoError(t, err)
+	assert.Equal(t, CustomRoleConflictFirst, policy)
+
+	_, err = ParseCustomRoleConflictPolicy("random")
+	assert.Error(t, err)
+}
+
+func TestHandlerShouldResolveCustomRoleConflicts(t *testing.T) {
+	sources := []CustomRoleSource{
+		{Label: "cloud.google.com/gke-nodepool"},
+		{Label: "eks.amazonaws.com/nodegroup", TrimPrefix: "ng-"},
+		{Label: "team"},
+	}
+
+	testCases := []struct {
+		name           string
+		policy         CustomRoleConflictPolicy
+		expectedLabels map[string]string
+	}{
+		{
+			name:   "all sources",
+			policy: CustomRoleConflictAll,
+			expectedLabels: map[string]string{
+				"eks.amazonaws.com/nodegroup":    "ng-gpu",
+				"team":                           "ml",
+				"node-role.kubernetes.io/worker": "",
+				"node-role.kubernetes.io/gpu":    "",
+				"node-role.kubernetes.io/ml":     "",
+			},
+		},
+		{
+			name:   "first source present",
+			policy: CustomRoleConflictFirst,
+			expectedLabels: map[string]string{
+				"eks.amazonaws.com/nodegroup":    "ng-gpu",
+				"team":                           "ml",
+				"node-role.kubernetes.io/worker": "",
+				"node-role.kubernetes.io/gpu":    "",
+			},
+		},
+		{
+			name:   "skip on conflict",
+			policy: CustomRoleConflictSkip,
+			expectedLabels: map[string]string{
+				"eks.amazonaws.com/nodegroup":    "ng-gpu",
+				"team":                           "ml",
+				"node-role.kubernetes.io/worker": "",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(MultiSourceWorkerNode)
+			testingMockDiscovery := TestingMockDiscovery{}
+			c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), CustomRoleSources: sources, CustomRolePolicy: tc.policy})
+			c.handler(MultiSourceWorkerNode)
+
+			foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), MultiSourceWorkerNode.Name, metav1.GetOptions{})
+			assert.Equal(t, tc.expectedLabels, foundNode.Labels)
+		})
+	}
+}
+
+func TestCustomRoleLabelValueSplitsAndSkipsInvalidRoles(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-multi-role-node",
+			Labels: map[string]string{
+				"customLabel": "gpu, ingress,,in valid,gpu",
+			},
+		},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	testingMockDiscovery := TestingMockDiscovery{}
+	recorder := record.NewFakeRecorder(10)
+
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), CustomRoleSources: []CustomRoleSource{{Label: "customLabel"}}, CustomRoleDelimiter: ","})
+	c.recorder = recorder
+	roles, err := c.getCustomRoleLabelValue(c.logger, node)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gpu", "ingress"}, roles)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, EventReasonInvalidCustomRole)
+}
+
+func TestHandlerShouldApplyValidCustomRolesIfOneIsInvalid(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-multi-role-node",
+			Labels: map[string]string{
+				"customLabel": "gpu,in valid",
+			},
+		},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	testingMockDiscovery := TestingMockDiscovery{}
+
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), CustomRoleSources: []CustomRoleSource{{Label: "customLabel"}}, CustomRoleDelimiter: ","})
+	c.recorder = record.NewFakeRecorder(10)
+	c.handler(node)
+
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Equal(t, map[string]string{
+		"customLabel":                    "gpu,in valid",
+		"node-role.kubernetes.io/worker": "",
+		"node-role.kubernetes.io/gpu":    "",
+	}, foundNode.Labels)
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Check is a single rule evaluated while labeling a node.
+type Check struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+}
+
+// Explanation describes why a node is labeled the way it is.
+type Explanation struct {
+	Node   string  `json:"node"`
+	Checks []Check `json:"checks"`
+	// Decisions holds the messages the controller logs while labeling the node.
+	Decisions     []string          `json:"decisions"`
+	ActualLabels  map[string]string `json:"actualLabels"`
+	DesiredLabels map[string]string `json:"desiredLabels"`
+	Added         map[string]string `json:"added"`
+	Removed       []string          `json:"removed"`
+}
+
+// Explain evaluates all rules for node without changing it. Events the
+// controller would record are dropped, its log messages are returned as
+// decisions instead.
+func (c NodeController) Explain(node *v1.Node) Explanation {
+	var decisions bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&decisions)
+	logger.SetLevel(log.DebugLevel)
+	logger.SetFormatter(&log.TextFormatter{DisableTimestamp: true})
+	r := reconcile{logger: logger}
+	c.recorder = &record.FakeRecorder{}
+
+	e := Explanation{
+		Node:          node.Name,
+		Checks:        []Check{},
+		Decisions:     []string{},
+		ActualLabels:  node.Labels,
+		DesiredLabels: node.Labels,
+		Added:         map[string]string{},
+		Removed:       []string{},
+	}
+	check := func(name string, format string, args ...interface{}) {
+		e.Checks = append(e.Checks, Check{Name: name, Result: fmt.Sprintf(format, args...)})
+	}
+
+	managed := c.isNodeManaged(node)
+	check("managed", "%t (node selector %q, %s annotation %q)", managed, c.nodeSelector, IgnoreNodeKey, node.Annotations[IgnoreNodeKey])
+	if c.shards != nil {
+		check("shard", "%d owned: %t", c.shards.ShardOf(node.Name), c.shards.Owns(node.Name))
+	}
+	initialized := c.isNodeInitialized(node)
+	check("initialized", "%t (taint %s)", initialized, strings.Join(c.waitForTaints, ", "))
+	if !managed || (!initialized && !c.preLabel) {
+		return e
+	}
+	if !initialized {
+		r.skipPrimaryRole = !c.isSpotKnown(node)
+		check("pre-label", "primary role skipped: %t", r.skipPrimaryRole)
+	}
+
+	check("control-plane", "%t (detector %T)", c.isControlPlaneNode(node), c.controlPlaneDetector)
+	// the provider is asked once, desiredNode below reuses its answer
+	isSpot := c.lazySpotInstance(context.Background(), r.logger, node)
+	spot, err := isSpot()
+	switch _, source, ok := c.labeledSpot(node); {
+	case ok:
+		check("spot", "%t (%s)", spot, source)
+	case err != nil:
+		check("spot", "unknown (provider %T, provider ID %q: %v)", c.spotInstanceDiscovery, node.Spec.ProviderID, err)
+	default:
+		check("spot", "%t (provider %T, provider ID %q)", spot, c.spotInstanceDiscovery, node.Spec.ProviderID)
+	}
+	if len(c.customRoleSources) > 0 {
+		roles, err := c.getCustomRoleLabelValue(r.logger, node)
+		if err != nil {
+			check("custom-roles", "none (%v)", err)
+		} else {
+			check("custom-roles", "%v (policy %s)", roles, c.customRolePolicy)
+		}
+	}
+	isKarpenterNode := c.isKarpenterNode(node)
+	check("karpenter", "%t (enabled %t, label %s %q, nodeclaim lookup %t)", isKarpenterNode, c.karpenterEnabled, NodeKarpenterManagedLabelKey, c.karpenterLabels(node)[NodeKarpenterManagedLabelKey], c.nodeClaims != nil)
+	sources := c.roleSources(node)
+	for _, source := range sources {
+		if source.enabled {
+			check(strings.ReplaceAll(source.name, " ", "-")+"-role", "%q", source.role)
+		}
+	}
+	if len(c.rolePrecedence) > 0 {
+		customRoles, _ := c.getCustomRoleLabelValue(r.logger, node)
+		roles := withRoles(customRoles, sourceRoles(sources)...)
+		check("primary-role", "%s (precedence %s)", c.primaryRole(node, roles, isKarpenterNode), strings.Join(c.rolePrecedence, ","))
+	}
+	for _, t := range c.labelTemplates {
+		key, value, ok, err := t.Render(node)
+		switch {
+		case err != nil:
+			check("label-template", "%s: %v", t, err)
+		case !ok:
+			check("label-template", "%s: rendered nothing", t)
+		default:
+			check("label-template", "%s: %s=%s", t, key, value)
+		}
+	}
+
+	for _, l := range c.conditionLabels {
+		check("condition-label", "%s: %t", l, l.met(node))
+	}
+	if c.startupTaint != "" {
+		check("startup-taint", "%t (taint %s)", slices.ContainsFunc(node.Spec.Taints, func(t v1.Taint) bool { return t.Key == c.startupTaint }), c.startupTaint)
+	}
+
+	// checks above may have logged already, only keep the labeling decisions
+	decisions.Reset()
+	nodeCopy, _, unresolved := c.desiredNode(context.Background(), r, node, isSpot)
+	if unresolved != nil {
+		check("unresolved", "%v", unresolved)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(decisions.String()), "\n") {
+		if line != "" {
+			e.Decisions = append(e.Decisions, line)
+		}
+	}
+
+	e.DesiredLabels = nodeCopy.Labels
+	e.Added, e.Removed = labelChanges(node, nodeCopy)
+	return e
+}
+
+// ExplainNode explains the node with the given name. The node is taken from
+// the informer cache if present, otherwise it's fetched from the API server.
+func (c NodeController) ExplainNode(ctx context.Context, name string) (Explanation, error) {
+	if obj, exists, err := c.store.GetByKey(name); err == nil && exists {
+		if node, ok := nodeFromObject(obj); ok {
+			return c.Explain(node), nil
+		}
+	}
+	node, err := c.client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return Explanation{}, err
+	}
+	return c.Explain(node), nil
+}
+
+// ServeExplain writes the explanation of the node given by the "node" query
+// parameter as JSON.
+func (c NodeController) ServeExplain(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("node")
+	if name == "" {
+		http.Error(w, "query parameter node is required", http.StatusBadRequest)
+		return
+	}
+	e, err := c.ExplainNode(req.Context(), name)
+	if apierrors.IsNotFound(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(e); err != nil {
+		log.Errorf("Failed to write explanation of node %s: %v", name, err)
+	}
+}
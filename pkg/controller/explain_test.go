@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestExplainShouldDescribeDesiredLabels(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-explain-node",
+			Labels: map[string]string{
+				"customLabel":       "gpu,in valid",
+				NodeRoleMasterLabel: "",
+			},
+		},
+		Spec: v1.NodeSpec{
+			ProviderID: "aws:///eu-central-1/i-123uzu123",
+		},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	recorder := record.NewFakeRecorder(10)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{CustomRoleSources: []CustomRoleSource{{Label: "customLabel"}}, CustomRoleDelimiter: ",", RolePrecedence: []string{RoleWorker, RoleControlPlane}})
+	c.recorder = recorder
+
+	e := c.Explain(node)
+
+	assert.Contains(t, e.Checks, Check{Name: "spot", Result: `true (provider controller.TestingMockDiscovery, provider ID "aws:///eu-central-1/i-123uzu123")`})
+	assert.Contains(t, e.Checks, Check{Name: "custom-roles", Result: "[gpu] (policy all)"})
+	assert.Contains(t, e.Checks, Check{Name: "primary-role", Result: "worker (precedence worker,control-plane)"})
+	assert.Equal(t, map[string]string{NodeRoleSpotWorkerLabel: "", "node-role.kubernetes.io/gpu": ""}, e.Added)
+	assert.Equal(t, []string{NodeRoleMasterLabel}, e.Removed)
+	assert.NotEmpty(t, e.Decisions)
+	assert.Empty(t, recorder.Events)
+
+	foundNode, _ := clientset.CoreV1().Nodes().Get(t.Context(), node.Name, metav1.GetOptions{})
+	assert.Equal(t, node.Labels, foundNode.Labels)
+}
+
+type countingDiscovery struct {
+	calls int
+}
+
+func (d *countingDiscovery) IsSpotInstance(logger log.FieldLogger, node *v1.Node) (bool, error) {
+	d.calls++
+	return true, nil
+}
+
+func TestExplainShouldAskSpotProviderOnce(t *testing.T) {
+	discovery := &countingDiscovery{}
+	c := NewNodeController(fake.NewSimpleClientset(WorkerNode), discovery, Config{})
+
+	e := c.Explain(WorkerNode)
+
+	assert.Contains(t, e.Checks, Check{Name: "spot", Result: `true (provider *controller.countingDiscovery, provider ID "aws:///eu-central-1/i-123qwe123")`})
+	assert.Equal(t, map[string]string{NodeRoleSpotWorkerLabel: ""}, e.Added)
+	assert.Equal(t, 1, discovery.calls)
+}
+
+func TestExplainShouldStopAtUninitializedNodes(t *testing.T) {
+	c := NewNodeController(fake.NewSimpleClientset(), TestingMockDiscovery{}, Config{})
+
+	e := c.Explain(UninitializedNode)
+
+	assert.Equal(t, Check{Name: "initialized", Result: "false (taint node.cloudprovider.kubernetes.io/uninitialized)"}, e.Checks[len(e.Checks)-1])
+	assert.Empty(t, e.Added)
+	assert.Empty(t, e.Decisions)
+}
+
+func TestServeExplain(t *testing.T) {
+	c := NewNodeController(fake.NewSimpleClientset(WorkerNode), TestingMockDiscovery{}, Config{})
+
+	recorder := httptest.NewRecorder()
+	c.ServeExplain(recorder, httptest.NewRequest(http.MethodGet, "/explain?node="+WorkerNode.Name, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var e Explanation
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &e))
+	assert.Equal(t, map[string]string{NodeRoleWorkerLabel: ""}, e.Added)
+
+	recorder = httptest.NewRecorder()
+	c.ServeExplain(recorder, httptest.NewRequest(http.MethodGet, "/explain?node=unknown", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	c.ServeExplain(recorder, httptest.NewRequest(http.MethodGet, "/explain", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
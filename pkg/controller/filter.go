@@ -0,0 +1,32 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// listSelector returns the label selector pushed down to the node list/watch.
+// It combines the configured node selector with the ignore label, so ignored
+// nodes never enter the informer cache.
+func listSelector(nodeSelector labels.Selector) labels.Selector {
+	if nodeSelector == nil {
+		nodeSelector = labels.Everything()
+	}
+	ignore, err := labels.NewRequirement(IgnoreNodeKey, selection.NotEquals, []string{"true"})
+	if err != nil {
+		// IgnoreNodeKey is a constant valid label key
+		panic(err)
+	}
+	return nodeSelector.Add(*ignore)
+}
+
+// isNodeManaged reports whether the controller may touch the node. The
+// selector is already applied by the list/watch, but the ignore annotation
+// can only be checked here.
+func (c NodeController) isNodeManaged(node *v1.Node) bool {
+	if !c.nodeSelector.Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	return node.Annotations[IgnoreNodeKey] != "true"
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestListSelector(t *testing.T) {
+	assert.Equal(t, "k8s-node-label.io/ignore!=true", listSelector(nil).String())
+
+	selector, _ := labels.Parse("node.kubernetes.io/instance-type!=metal")
+	assert.Equal(t, "k8s-node-label.io/ignore!=true,node.kubernetes.io/instance-type!=metal", listSelector(selector).String())
+}
+
+func TestHandlerShouldSkipUnmanagedNodes(t *testing.T) {
+	ignoredByLabel := WorkerNode.DeepCopy()
+	ignoredByLabel.Labels = map[string]string{IgnoreNodeKey: "true"}
+
+	ignoredByAnnotation := WorkerNode.DeepCopy()
+	ignoredByAnnotation.Annotations = map[string]string{IgnoreNodeKey: "true"}
+
+	notSelected := WorkerNode.DeepCopy()
+	notSelected.Labels = map[string]string{"node.kubernetes.io/instance-type": "metal"}
+
+	notIgnored := WorkerNode.DeepCopy()
+	notIgnored.Annotations = map[string]string{IgnoreNodeKey: "false"}
+
+	selector, _ := labels.Parse("node.kubernetes.io/instance-type!=metal")
+
+	testCases := []struct {
+		name          string
+		node          *v1.Node
+		expectedLabel bool
+	}{
+		{name: "ignored by label", node: ignoredByLabel},
+		{name: "ignored by annotation", node: ignoredByAnnotation},
+		{name: "not selected", node: notSelected},
+		{name: "ignore annotation set to false", node: notIgnored, expectedLabel: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tc.node)
+			testingMockDiscovery := TestingMockDiscovery{}
+			c := NewNodeController(clientset, testingMockDiscovery, Config{NodeSelector: selector})
+			c.handler(tc.node)
+
+			foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), tc.node.Name, metav1.GetOptions{})
+			_, ok := foundNode.Labels[NodeRoleWorkerLabel]
+			assert.Equal(t, tc.expectedLabel, ok)
+		})
+	}
+}
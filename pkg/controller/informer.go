@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+var nodeResource = v1.SchemeGroupVersion.WithResource("nodes")
+
+// newInformer watches either full node objects or, in metadata-only mode,
+// PartialObjectMetadata of the selected nodes.
+func (c NodeController) newInformer(resyncPeriod time.Duration) (cache.Store, cache.Controller) {
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.handler,
+		UpdateFunc: func(old, new interface{}) { c.handler(new) },
+	}
+	tweakListOptions := func(options *metav1.ListOptions) {
+		options.LabelSelector = c.nodeSelector.String()
+	}
+
+	if c.metadataClient != nil {
+		nodes := c.metadataClient.Resource(nodeResource)
+		store, controller := cache.NewInformerWithOptions(cache.InformerOptions{
+			ListerWatcher: &cache.ListWatch{
+				ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+					tweakListOptions(&options)
+					return nodes.List(ctx, options)
+				},
+				WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+					tweakListOptions(&options)
+					return nodes.Watch(ctx, options)
+				},
+			},
+			ObjectType:   &metav1.PartialObjectMetadata{},
+			Handler:      handler,
+			ResyncPeriod: resyncPeriod,
+			Transform:    stripManagedFields,
+		})
+		return store, controller
+	}
+
+	store, controller := cache.NewInformerWithOptions(cache.InformerOptions{
+		ListerWatcher: cache.NewFilteredListWatchFromClient(
+			c.client.CoreV1().RESTClient(),
+			"nodes",
+			v1.NamespaceAll,
+			tweakListOptions),
+		ObjectType:   &v1.Node{},
+		Handler:      handler,
+		ResyncPeriod: resyncPeriod,
+		Transform:    stripNodeStatus,
+	})
+	return store, controller
+}
+
+// stripNodeStatus drops the parts of a node the controller never reads,
+// container images being by far the largest, before it's cached.
+func stripNodeStatus(obj interface{}) (interface{}, error) {
+	if node, ok := obj.(*v1.Node); ok {
+		node.ManagedFields = nil
+		node.Status.Images = nil
+		node.Status.VolumesInUse = nil
+		node.Status.VolumesAttached = nil
+	}
+	return obj, nil
+}
+
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if m, ok := obj.(metav1.Object); ok {
+		m.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
+// nodeFromObject returns the node of an informer event. In metadata-only mode
+// only the node's ObjectMeta is known.
+func nodeFromObject(obj interface{}) (*v1.Node, bool) {
+	switch o := obj.(type) {
+	case *v1.Node:
+		return o, true
+	case *metav1.PartialObjectMetadata:
+		return &v1.Node{ObjectMeta: o.ObjectMeta}, true
+	}
+	return nil, false
+}
+
+// updateNode writes the labels of nodeCopy. Nodes built from metadata only
+// must not be sent as a whole, so their labels are merge patched instead.
+func (c NodeController) updateNode(ctx context.Context, node *v1.Node, nodeCopy *v1.Node) (err error) {
+	ctx, span := tracer.Start(ctx, "updateNode", trace.WithAttributes(
+		attribute.String("k8s.node.name", node.Name),
+		attribute.Bool("metadata_only", c.metadataClient != nil),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if c.metadataClient == nil {
+		_, err := c.client.CoreV1().Nodes().Update(ctx, nodeCopy, metav1.UpdateOptions{})
+		return err
+	}
+
+	labels := make(map[string]interface{})
+	for k, v := range nodeCopy.Labels {
+		if old, ok := node.Labels[k]; !ok || old != v {
+			labels[k] = v
+		}
+	}
+	for k := range node.Labels {
+		if _, ok := nodeCopy.Labels[k]; !ok {
+			labels[k] = nil
+		}
+	}
+
+	meta := map[string]interface{}{
+		"labels": labels,
+	}
+	if node.ResourceVersion != "" {
+		// fail on concurrent modifications like Update does
+		meta["resourceVersion"] = node.ResourceVersion
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": meta})
+	if err != nil {
+		return err
+	}
+	_, err = c.client.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
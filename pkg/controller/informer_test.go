@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fake "k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+func TestStripNodeStatus(t *testing.T) {
+	node := WorkerNode.DeepCopy()
+	node.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubelet"}}
+	node.Status.Images = []v1.ContainerImage{{Names: []string{"nginx"}}}
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+
+	obj, err := stripNodeStatus(node)
+	assert.NoError(t, err)
+
+	stripped := obj.(*v1.Node)
+	assert.Nil(t, stripped.ManagedFields)
+	assert.Nil(t, stripped.Status.Images)
+	assert.Equal(t, node.Spec, stripped.Spec)
+	assert.Len(t, stripped.Status.Conditions, 1)
+}
+
+func TestHandlerShouldPatchLabelsInMetadataOnlyMode(t *testing.T) {
+	node := ControlPlaneNode.DeepCopy()
+	node.Labels = map[string]string{
+		"node-role.kubernetes.io/control-plane": "",
+		NodeRoleWorkerLabel:                     "",
+	}
+	clientset := fake.NewSimpleClientset(node)
+	metadataClient := metadatafake.NewSimpleMetadataClient(runtime.NewScheme())
+	partial := &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Node"},
+		ObjectMeta: node.ObjectMeta,
+	}
+
+	controlPlaneLabels, _ := controlplane.NewLabelDetector("node-role.kubernetes.io/control-plane")
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{
+		ControlPlaneDetector: controlPlaneLabels,
+		RolePrecedence:       []string{RoleControlPlane, RoleWorker},
+		MetadataClient:       metadataClient,
+	})
+	c.handler(partial)
+
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Equal(t, map[string]string{NodeRoleControlPlaneLabel: ""}, foundNode.Labels)
+	assert.Equal(t, node.Spec.Taints, foundNode.Spec.Taints)
+}
+
+func TestRunShouldLabelNodesAndReturnAfterStop(t *testing.T) {
+	clientset := fake.NewSimpleClientset(WorkerNode)
+	scheme := runtime.NewScheme()
+	metav1.AddMetaToScheme(scheme)
+	metadataClient := metadatafake.NewSimpleMetadataClient(scheme, &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Node"},
+		ObjectMeta: WorkerNode.ObjectMeta,
+	})
+
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{MetadataClient: metadataClient})
+
+	stopCh := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		c.Run(stopCh)
+		close(stopped)
+	}()
+
+	assert.Eventually(t, func() bool {
+		foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), WorkerNode.Name, metav1.GetOptions{})
+		_, ok := foundNode.Labels[NodeRoleWorkerLabel]
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(stopCh)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected Run to return after stop")
+	}
+}
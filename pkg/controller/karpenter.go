@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// NodeClaimLookup returns the labels of the Karpenter NodeClaim a node was
+// launched from, or nil if there is none.
+type NodeClaimLookup interface {
+	NodeClaimLabels(node *v1.Node) map[string]string
+}
+
+// karpenterLabels returns the labels Karpenter decided for node. Karpenter
+// copies them from the NodeClaim once the node registered, until then they
+// are taken from the NodeClaim if a lookup is configured.
+func (c NodeController) karpenterLabels(node *v1.Node) map[string]string {
+	if _, ok := node.Labels[NodeKarpenterManagedLabelKey]; ok || c.nodeClaims == nil {
+		return node.Labels
+	}
+	if claimLabels := c.nodeClaims.NodeClaimLabels(node); claimLabels != nil {
+		if _, ok := claimLabels[NodeKarpenterManagedLabelKey]; ok {
+			return claimLabels
+		}
+	}
+	return node.Labels
+}
+
+// isNodeClaimPending reports whether node was launched by Karpenter but has
+// neither its labels nor a cached NodeClaim yet. Karpenter registers its
+// nodes with the karpenter.sh/unregistered taint.
+func (c NodeController) isNodeClaimPending(node *v1.Node) bool {
+	if !c.karpenterEnabled || c.nodeClaims == nil {
+		return false
+	}
+	if _, ok := node.Labels[NodeKarpenterManagedLabelKey]; ok {
+		return false
+	}
+	if !slices.ContainsFunc(node.Spec.Taints, func(t v1.Taint) bool { return t.Key == NodeKarpenterUnregistered }) {
+		return false
+	}
+	return c.nodeClaims.NodeClaimLabels(node) == nil
+}
+
+func (c NodeController) isKarpenterNode(node *v1.Node) bool {
+	if !c.karpenterEnabled {
+		return false
+	}
+	_, ok := c.karpenterLabels(node)[NodeKarpenterManagedLabelKey]
+	return ok
+}
+
+// karpenterNodePoolRole returns the role named after the nodepool of a
+// Karpenter node, or an empty string if nodepool roles are disabled.
+func (c NodeController) karpenterNodePoolRole(node *v1.Node) string {
+	if !c.karpenterEnabled || !c.karpenterNodePoolRoles {
+		return ""
+	}
+	return c.karpenterLabels(node)[NodeKarpenterManagedLabelKey]
+}
+
+// karpenterCapacityTypeOf returns the capacity type of a Karpenter node if
+// it's used for spot detection.
+func (c NodeController) karpenterCapacityTypeOf(node *v1.Node) (string, bool) {
+	if !c.karpenterEnabled || !c.karpenterCapacityType {
+		return "", false
+	}
+	capacityType, ok := c.karpenterLabels(node)[NodeKarpenterCapacityTypeKey]
+	return capacityType, ok && capacityType != ""
+}
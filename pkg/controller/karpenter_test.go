@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+type testingNodeClaims map[string]map[string]string
+
+func (n testingNodeClaims) NodeClaimLabels(node *v1.Node) map[string]string {
+	return n[node.Name]
+}
+
+func TestKarpenterIntegration(t *testing.T) {
+	spotNode := KarpenterWorkerNode.DeepCopy()
+	spotNode.Labels[NodeKarpenterCapacityTypeKey] = KarpenterCapacityTypeSpot
+	launchingNode := WorkerNode.DeepCopy()
+
+	testCases := []struct {
+		name           string
+		config         Config
+		node           *v1.Node
+		expectedLabels map[string]string
+	}{
+		{
+			name:   "nodepool role",
+			config: Config{KarpenterEnabled: true, KarpenterNodePoolRoles: true},
+			node:   KarpenterWorkerNode,
+			expectedLabels: map[string]string{
+				NodeKarpenterManagedLabelKey:        "some-pool",
+				NodeRoleWorkerLabel:                 "",
+				NodeKarpenterLabel:                  "",
+				"node-role.kubernetes.io/some-pool": "",
+			},
+		},
+		{
+			name:   "nodepool role is exclusive",
+			config: Config{KarpenterEnabled: true, KarpenterNodePoolRoles: true, RolePrecedence: []string{"some-pool", RoleWorker}},
+			node:   KarpenterWorkerNode,
+			expectedLabels: map[string]string{
+				NodeKarpenterManagedLabelKey:        "some-pool",
+				NodeKarpenterLabel:                  "",
+				"node-role.kubernetes.io/some-pool": "",
+			},
+		},
+		{
+			name:   "capacity type decides spot",
+			config: Config{KarpenterEnabled: true, KarpenterCapacityType: true},
+			node:   spotNode,
+			expectedLabels: map[string]string{
+				NodeKarpenterManagedLabelKey: "some-pool",
+				NodeKarpenterCapacityTypeKey: KarpenterCapacityTypeSpot,
+				NodeRoleSpotWorkerLabel:      "",
+				NodeKarpenterLabel:           "",
+			},
+		},
+		{
+			name:   "capacity type ignored unless enabled",
+			config: Config{KarpenterEnabled: true},
+			node:   spotNode,
+			expectedLabels: map[string]string{
+				NodeKarpenterManagedLabelKey: "some-pool",
+				NodeKarpenterCapacityTypeKey: KarpenterCapacityTypeSpot,
+				NodeRoleWorkerLabel:          "",
+				NodeKarpenterLabel:           "",
+			},
+		},
+		{
+			name: "labels from nodeclaim",
+			config: Config{
+				KarpenterEnabled:       true,
+				KarpenterNodePoolRoles: true,
+				KarpenterCapacityType:  true,
+				NodeClaims: testingNodeClaims{launchingNode.Name: {
+					NodeKarpenterManagedLabelKey: "gpu",
+					NodeKarpenterCapacityTypeKey: KarpenterCapacityTypeSpot,
+				}},
+			},
+			node: launchingNode,
+			expectedLabels: map[string]string{
+				NodeRoleSpotWorkerLabel:       "",
+				NodeKarpenterLabel:            "",
+				"node-role.kubernetes.io/gpu": "",
+			},
+		},
+		{
+			name:   "karpenter disabled",
+			config: Config{KarpenterNodePoolRoles: true, KarpenterCapacityType: true},
+			node:   spotNode,
+			expectedLabels: map[string]string{
+				NodeKarpenterManagedLabelKey: "some-pool",
+				NodeKarpenterCapacityTypeKey: KarpenterCapacityTypeSpot,
+				NodeRoleWorkerLabel:          "",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tc.node)
+			c := NewNodeController(clientset, TestingMockDiscovery{}, tc.config)
+			c.handler(tc.node)
+
+			foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), tc.node.Name, metav1.GetOptions{})
+			assert.Equal(t, tc.expectedLabels, foundNode.Labels)
+		})
+	}
+}
+
+func TestIsSpotKnownByKarpenterCapacityType(t *testing.T) {
+	node := KarpenterWorkerNode.DeepCopy()
+	node.Spec.ProviderID = ""
+	node.Labels[NodeKarpenterCapacityTypeKey] = "on-demand"
+
+	c := NewNodeController(fake.NewSimpleClientset(), TestingMockDiscovery{}, Config{KarpenterEnabled: true})
+	assert.False(t, c.isSpotKnown(node))
+
+	c = NewNodeController(fake.NewSimpleClientset(), TestingMockDiscovery{}, Config{KarpenterEnabled: true, KarpenterCapacityType: true})
+	assert.True(t, c.isSpotKnown(node))
+}
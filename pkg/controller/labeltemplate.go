@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// LabelTemplate is a label rule whose key and value are Go templates
+// evaluated against the Node object, e.g.
+// topology.example.com/rack={{ index .Labels "rack" | lower }}
+type LabelTemplate struct {
+	rule       string
+	key        *template.Template
+	value      *template.Template
+	emptyValue bool
+}
+
+var templateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"regexFind": func(expr, s string) (string, error) {
+		r, err := regexp.Compile(expr)
+		if err != nil {
+			return "", err
+		}
+		return r.FindString(s), nil
+	},
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+}
+
+// ParseLabelTemplate parses a rule of the form KEY=VALUE where both sides
+// may contain template actions.
+func ParseLabelTemplate(rule string) (LabelTemplate, error) {
+	keyText, valueText, found := splitLabelTemplateRule(rule)
+	if !found {
+		return LabelTemplate{}, fmt.Errorf("label template %q must have the form KEY=VALUE", rule)
+	}
+	if strings.TrimSpace(keyText) == "" {
+		return LabelTemplate{}, fmt.Errorf("label template %q has an empty key", rule)
+	}
+
+	key, err := template.New("key").Funcs(templateFuncs).Option("missingkey=zero").Parse(keyText)
+	if err != nil {
+		return LabelTemplate{}, fmt.Errorf("label template %q has an invalid key: %v", rule, err)
+	}
+	value, err := template.New("value").Funcs(templateFuncs).Option("missingkey=zero").Parse(valueText)
+	if err != nil {
+		return LabelTemplate{}, fmt.Errorf("label template %q has an invalid value: %v", rule, err)
+	}
+
+	return LabelTemplate{
+		rule:       rule,
+		key:        key,
+		value:      value,
+		emptyValue: valueText == "",
+	}, nil
+}
+
+// Render evaluates the template against node. ok is false when the rule
+// doesn't apply to the node, i.e. the key rendered empty or a non-empty
+// value template rendered empty.
+func (t LabelTemplate) Render(node *v1.Node) (key string, value string, ok bool, err error) {
+	key, err = execute(t.key, node)
+	if err != nil {
+		return "", "", false, err
+	}
+	if !t.emptyValue {
+		value, err = execute(t.value, node)
+		if err != nil {
+			return "", "", false, err
+		}
+	}
+
+	if key == "" || (value == "" && !t.emptyValue) {
+		return "", "", false, nil
+	}
+
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return "", "", false, fmt.Errorf("rendered key %q is not a valid label key: %s", key, strings.Join(errs, "; "))
+	}
+	if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+		return "", "", false, fmt.Errorf("rendered value %q is not a valid label value: %s", value, strings.Join(errs, "; "))
+	}
+
+	return key, value, true, nil
+}
+
+func (t LabelTemplate) String() string {
+	return t.rule
+}
+
+func execute(t *template.Template, node *v1.Node) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, node); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// splitLabelTemplateRule splits the rule at the first "=" that is not part
+// of a template action, so values like {{ if eq .Name "a" }} keep working.
+func splitLabelTemplateRule(rule string) (string, string, bool) {
+	depth := 0
+	for i := 0; i < len(rule); i++ {
+		switch {
+		case strings.HasPrefix(rule[i:], "{{"):
+			depth++
+			i++
+		case strings.HasPrefix(rule[i:], "}}"):
+			depth--
+			i++
+		case rule[i] == '=' && depth == 0:
+			return rule[:i], rule[i+1:], true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+var RackWorkerNode = &v1.Node{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "gpu-pool-abc12",
+		Labels: map[string]string{
+			"rack": "RACK-42",
+		},
+	},
+	Spec: v1.NodeSpec{
+		ProviderID: "aws:///eu-central-1/i-123qwe123",
+	},
+}
+
+func TestParseLabelTemplateErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		rule string
+	}{
+		{name: "missing separator", rule: "topology.example.com/rack"},
+		{name: "empty key", rule: "=value"},
+		{name: "invalid key template", rule: "{{ .Name =value"},
+		{name: "invalid value template", rule: "key={{ unknownFunc .Name }}"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseLabelTemplate(tc.rule)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLabelTemplateRender(t *testing.T) {
+	testCases := []struct {
+		name          string
+		rule          string
+		expectedKey   string
+		expectedValue string
+		expectedOk    bool
+		expectedErr   bool
+	}{
+		{
+			name:          "label value lowered",
+			rule:          `topology.example.com/rack={{ index .Labels "rack" | lower }}`,
+			expectedKey:   "topology.example.com/rack",
+			expectedValue: "rack-42",
+			expectedOk:    true,
+		},
+		{
+			name:          "pool from node name prefix",
+			rule:          `example.com/pool={{ regexFind "^[a-z]+-pool" .Name }}`,
+			expectedKey:   "example.com/pool",
+			expectedValue: "gpu-pool",
+			expectedOk:    true,
+		},
+		{
+			name:          "templated key with empty value",
+			rule:          `node-role.kubernetes.io/{{ index (split "-" .Name) 0 }}=`,
+			expectedKey:   "node-role.kubernetes.io/gpu",
+			expectedValue: "",
+			expectedOk:    true,
+		},
+		{
+			name:          "equal sign inside template action",
+			rule:          `example.com/gpu={{ if eq (index (split "-" .Name) 0) "gpu" }}true{{ end }}`,
+			expectedKey:   "example.com/gpu",
+			expectedValue: "true",
+			expectedOk:    true,
+		},
+		{
+			name:       "missing source label skips rule",
+			rule:       `example.com/zone={{ index .Labels "zone" }}`,
+			expectedOk: false,
+		},
+		{
+			name:        "invalid rendered key",
+			rule:        `example.com/{{ index .Labels "rack" }}!=`,
+			expectedErr: true,
+		},
+		{
+			name:        "invalid rendered value",
+			rule:        `example.com/rack={{ index .Labels "rack" }} {{ .Name }}`,
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := ParseLabelTemplate(tc.rule)
+			assert.NoError(t, err)
+
+			key, value, ok, err := tmpl.Render(RackWorkerNode)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedOk, ok)
+			assert.Equal(t, tc.expectedKey, key)
+			assert.Equal(t, tc.expectedValue, value)
+		})
+	}
+}
+
+func TestHandlerShouldSetTemplatedLabels(t *testing.T) {
+	clientset := fake.NewSimpleClientset(RackWorkerNode)
+	testingMockDiscovery := TestingMockDiscovery{}
+
+	rack, _ := ParseLabelTemplate(`topology.example.com/rack={{ index .Labels "rack" | lower }}`)
+	invalid, _ := ParseLabelTemplate(`example.com/{{ index .Labels "rack" }}!=`)
+	c := NewNodeController(clientset, testingMockDiscovery, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel), LabelTemplates: []LabelTemplate{rack, invalid}})
+	c.handler(RackWorkerNode)
+
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), RackWorkerNode.Name, metav1.GetOptions{})
+	assert.Equal(t, map[string]string{
+		"rack":                           "RACK-42",
+		"topology.example.com/rack":      "rack-42",
+		"node-role.kubernetes.io/worker": "",
+	}, foundNode.Labels)
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// staticControlPlane keeps the control-plane decision made on the original node.
+type staticControlPlane bool
+
+func (s staticControlPlane) IsControlPlane(*v1.Node) bool {
+	return bool(s)
+}
+
+// ManagedLabels returns the labels the controller sets on node regardless
+// of whether it already carries them, e.g. to predict the labels of new
+// nodes of the same group. Condition labels are left out, they depend on
+// the state of a running node. Unmanaged nodes return nil.
+func (c NodeController) ManagedLabels(node *v1.Node) map[string]string {
+	if !c.isNodeManaged(node) {
+		return nil
+	}
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	r := reconcile{logger: logger}
+	c.recorder = &record.FakeRecorder{}
+	c.conditionLabels = nil
+	c.startupTaint = ""
+	// label based detection must not miss the role labels stripped below
+	c.controlPlaneDetector = staticControlPlane(c.isControlPlaneNode(node))
+
+	stripped := node.DeepCopy()
+	stripped.Labels = make(map[string]string)
+	for k, v := range node.Labels {
+		if !c.isManagedLabelKey(node, k) {
+			stripped.Labels[k] = v
+		}
+	}
+
+	desired, _, _ := c.desiredNode(context.Background(), r, stripped, c.lazySpotInstance(context.Background(), r.logger, stripped))
+	added, _ := labelChanges(stripped, desired)
+	return added
+}
+
+// isManagedLabelKey reports whether the controller may write the label key on node.
+func (c NodeController) isManagedLabelKey(node *v1.Node, key string) bool {
+	switch key {
+	case c.roleLabels.Key, ExcludeDisruptionLabel, ExcludeLoadBalancerLabel, AlphaExcludeLoadBalancerLabel:
+		return true
+	}
+	if strings.HasPrefix(key, c.roleLabels.Prefix) {
+		return true
+	}
+	for _, t := range c.labelTemplates {
+		if templateKey, _, ok, err := t.Render(node); err == nil && ok && templateKey == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestManagedLabels(t *testing.T) {
+	template, _ := ParseLabelTemplate(`topology.example.com/zone={{ index .Labels "topology.kubernetes.io/zone" }}`)
+	labeled := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "labeled-spot-worker",
+			Labels: map[string]string{
+				"topology.kubernetes.io/zone":   "eu-central-1a",
+				"topology.example.com/zone":     "eu-central-1a",
+				NodeRoleSpotWorkerLabel:         "",
+				"node-role.kubernetes.io/stale": "",
+			},
+		},
+		Spec: v1.NodeSpec{ProviderID: "aws:///eu-central-1/i-123uzu123"},
+	}
+
+	original := labeled.DeepCopy()
+
+	c := NewNodeController(fake.NewSimpleClientset(), TestingMockDiscovery{}, Config{LabelTemplates: []LabelTemplate{template}})
+	assert.Equal(t, map[string]string{
+		NodeRoleSpotWorkerLabel:     "",
+		"topology.example.com/zone": "eu-central-1a",
+	}, c.ManagedLabels(labeled))
+	assert.Equal(t, original, labeled, "node must not change")
+
+	ignored := labeled.DeepCopy()
+	ignored.Annotations = map[string]string{IgnoreNodeKey: "true"}
+	assert.Nil(t, c.ManagedLabels(ignored))
+}
+
+func TestManagedLabelsKeepsLabelBasedControlPlaneDetection(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "control-plane",
+		Labels: map[string]string{NodeRoleControlPlaneLabel: ""},
+	}}
+	detector, _ := controlplane.NewLabelDetector(NodeRoleControlPlaneLabel)
+
+	c := NewNodeController(fake.NewSimpleClientset(), TestingMockDiscovery{}, Config{ControlPlaneDetector: detector})
+	assert.Equal(t, map[string]string{NodeRoleControlPlaneLabel: ""}, c.ManagedLabels(node))
+}
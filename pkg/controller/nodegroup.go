@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// NodeGroupMapper turns the labels a managed Kubernetes offering puts on
+// the nodes of its node groups into role and spot labels.
+type NodeGroupMapper struct {
+	Name string
+	// NodeGroupLabel holds the name of the node group, it becomes a role of the node.
+	NodeGroupLabel string
+	// SpotLabels mark spot nodes, a node is spot if it carries one of them with the given value.
+	SpotLabels map[string]string
+}
+
+// NodeGroupMappers are the built-in mappers by provider name.
+var NodeGroupMappers = map[string]NodeGroupMapper{
+	"eks": {
+		Name:           "eks",
+		NodeGroupLabel: "eks.amazonaws.com/nodegroup",
+		SpotLabels:     map[string]string{"eks.amazonaws.com/capacityType": "SPOT"},
+	},
+	"gke": {
+		Name:           "gke",
+		NodeGroupLabel: "cloud.google.com/gke-nodepool",
+		SpotLabels: map[string]string{
+			"cloud.google.com/gke-spot":        "true",
+			"cloud.google.com/gke-preemptible": "true",
+		},
+	},
+	"aks": {
+		Name:           "aks",
+		NodeGroupLabel: "kubernetes.azure.com/agentpool",
+		SpotLabels:     map[string]string{"kubernetes.azure.com/scalesetpriority": "spot"},
+	},
+}
+
+// ParseNodeGroupMappers parses a comma separated list of provider names.
+func ParseNodeGroupMappers(providers string) ([]NodeGroupMapper, error) {
+	if strings.TrimSpace(providers) == "" {
+		return nil, nil
+	}
+
+	var mappers []NodeGroupMapper
+	for _, name := range strings.Split(providers, ",") {
+		mapper, ok := NodeGroupMappers[strings.TrimSpace(name)]
+		if !ok {
+			var available []string
+			for n := range NodeGroupMappers {
+				available = append(available, n)
+			}
+			sort.Strings(available)
+			return nil, fmt.Errorf("unknown managed node group provider %q, available values: (%s)", name, strings.Join(available, ", "))
+		}
+		mappers = append(mappers, mapper)
+	}
+	return mappers, nil
+}
+
+// nodeGroup returns the mapper of the first configured provider whose node
+// group label the node carries, and the node group name.
+func (c NodeController) nodeGroup(node *v1.Node) (NodeGroupMapper, string, bool) {
+	for _, m := range c.nodeGroupMappers {
+		if name := node.Labels[m.NodeGroupLabel]; name != "" {
+			return m, name, true
+		}
+	}
+	return NodeGroupMapper{}, "", false
+}
+
+// isSpot reports whether node is spot according to the mapper.
+func (m NodeGroupMapper) isSpot(node *v1.Node) bool {
+	for k, v := range m.SpotLabels {
+		if node.Labels[k] == v {
+			return true
+		}
+	}
+	return false
+}
+
+// labeledSpot decides spot nodes by labels of Karpenter or a managed node
+// group instead of asking the spot provider. It returns where the decision
+// came from, ok is false if the labels don't tell.
+func (c NodeController) labeledSpot(node *v1.Node) (isSpot bool, source string, ok bool) {
+	if capacityType, ok := c.karpenterCapacityTypeOf(node); ok {
+		return capacityType == KarpenterCapacityTypeSpot, fmt.Sprintf("karpenter capacity type %q", capacityType), true
+	}
+	if m, name, ok := c.nodeGroup(node); ok {
+		return m.isSpot(node), fmt.Sprintf("%s node group %q", m.Name, name), true
+	}
+	return false, "", false
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseNodeGroupMappers(t *testing.T) {
+	mappers, err := ParseNodeGroupMappers("eks, aks")
+	assert.NoError(t, err)
+	assert.Equal(t, []NodeGroupMapper{NodeGroupMappers["eks"], NodeGroupMappers["aks"]}, mappers)
+
+	mappers, err = ParseNodeGroupMappers("")
+	assert.NoError(t, err)
+	assert.Nil(t, mappers)
+
+	_, err = ParseNodeGroupMappers("eks,openshift")
+	assert.EqualError(t, err, `unknown managed node group provider "openshift", available values: (aks, eks, gke)`)
+}
+
+func TestManagedNodeGroupLabeling(t *testing.T) {
+	all, _ := ParseNodeGroupMappers("eks,gke,aks")
+
+	testCases := []struct {
+		name           string
+		mappers        []NodeGroupMapper
+		labels         map[string]string
+		expectedLabels map[string]string
+	}{
+		{
+			name:    "eks spot node group",
+			mappers: all,
+			labels: map[string]string{
+				"eks.amazonaws.com/nodegroup":    "batch",
+				"eks.amazonaws.com/capacityType": "SPOT",
+			},
+			expectedLabels: map[string]string{
+				"eks.amazonaws.com/nodegroup":    "batch",
+				"eks.amazonaws.com/capacityType": "SPOT",
+				NodeRoleSpotWorkerLabel:          "",
+				"node-role.kubernetes.io/batch":  "",
+			},
+		},
+		{
+			name:    "gke on-demand node pool",
+			mappers: all,
+			labels: map[string]string{
+				"cloud.google.com/gke-nodepool": "default-pool",
+			},
+			expectedLabels: map[string]string{
+				"cloud.google.com/gke-nodepool":        "default-pool",
+				NodeRoleWorkerLabel:                    "",
+				"node-role.kubernetes.io/default-pool": "",
+			},
+		},
+		{
+			name:    "gke spot node pool",
+			mappers: all,
+			labels: map[string]string{
+				"cloud.google.com/gke-nodepool": "spot-pool",
+				"cloud.google.com/gke-spot":     "true",
+			},
+			expectedLabels: map[string]string{
+				"cloud.google.com/gke-nodepool":     "spot-pool",
+				"cloud.google.com/gke-spot":         "true",
+				NodeRoleSpotWorkerLabel:             "",
+				"node-role.kubernetes.io/spot-pool": "",
+			},
+		},
+		{
+			name:    "aks spot agent pool",
+			mappers: all,
+			labels: map[string]string{
+				"kubernetes.azure.com/agentpool":        "spotpool",
+				"kubernetes.azure.com/scalesetpriority": "spot",
+			},
+			expectedLabels: map[string]string{
+				"kubernetes.azure.com/agentpool":        "spotpool",
+				"kubernetes.azure.com/scalesetpriority": "spot",
+				NodeRoleSpotWorkerLabel:                 "",
+				"node-role.kubernetes.io/spotpool":      "",
+			},
+		},
+		{
+			name:    "provider not selected",
+			mappers: []NodeGroupMapper{NodeGroupMappers["eks"]},
+			labels: map[string]string{
+				"kubernetes.azure.com/agentpool":        "spotpool",
+				"kubernetes.azure.com/scalesetpriority": "spot",
+			},
+			expectedLabels: map[string]string{
+				"kubernetes.azure.com/agentpool":        "spotpool",
+				"kubernetes.azure.com/scalesetpriority": "spot",
+				NodeRoleWorkerLabel:                     "",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "managed-node", Labels: tc.labels}}
+			clientset := fake.NewSimpleClientset(node)
+			c := NewNodeController(clientset, TestingMockDiscovery{}, Config{NodeGroupMappers: tc.mappers})
+			c.handler(node)
+
+			foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+			assert.Equal(t, tc.expectedLabels, foundNode.Labels)
+		})
+	}
+}
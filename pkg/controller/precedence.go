@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ParseRolePrecedence parses a comma separated list of exclusive roles,
+// ordered from highest to lowest precedence.
+func ParseRolePrecedence(precedence string) ([]string, error) {
+	if strings.TrimSpace(precedence) == "" {
+		return nil, nil
+	}
+
+	var roles []string
+	for _, role := range strings.Split(precedence, ",") {
+		role = strings.TrimSpace(role)
+		if role == "" {
+			return nil, fmt.Errorf("role precedence %q contains an empty role", precedence)
+		}
+		if slices.Contains(roles, role) {
+			return nil, fmt.Errorf("role precedence %q contains role %s twice", precedence, role)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// isExclusiveRole reports whether role takes part in the primary role
+// selection instead of being added next to other roles.
+func (c NodeController) isExclusiveRole(role string) bool {
+	return slices.Contains(c.rolePrecedence, role)
+}
+
+// primaryRole returns the role with the highest precedence the node
+// qualifies for. Nodes always qualify for either control-plane or worker,
+// which is used if none of their roles is listed.
+func (c NodeController) primaryRole(node *v1.Node, customRoles []string, isKarpenterNode bool) string {
+	baseRole := RoleWorker
+	if c.isControlPlaneNode(node) {
+		baseRole = RoleControlPlane
+	}
+
+	for _, role := range c.rolePrecedence {
+		if role == baseRole || slices.Contains(customRoles, role) || (role == RoleKarpenter && isKarpenterNode) {
+			return role
+		}
+	}
+	return baseRole
+}
+
+// withRoles returns roles with extra appended, skipping empty and already listed roles.
+func withRoles(roles []string, extra ...string) []string {
+	result := slices.Clone(roles)
+	for _, role := range extra {
+		if role != "" && !slices.Contains(result, role) {
+			result = append(result, role)
+		}
+	}
+	return result
+}
+
+// markPrimaryRole adds the labels of the primary role to nodeCopy and
+// removes the labels of all other exclusive roles, so the switch happens
+// within a single update. It returns the reasons of all changes, or an
+// error and no changes if the spot provider can't tell yet.
+func (c NodeController) markPrimaryRole(node *v1.Node, nodeCopy *v1.Node, primary string, isSpot func() (bool, error)) (reasons, error) {
+	var changes reasons
+
+	switch primary {
+	case RoleControlPlane:
+		if !isAlreadyMarkedControlPlane(node, c.roleLabels) || (c.controlPlaneLegacyLabel && !isAlreadyMarkedMaster(node, c.roleLabels)) {
+			spot, err := isSpot()
+			if err != nil {
+				return nil, err
+			}
+			changes.apply(nodeCopy, func() {
+				addControlPlaneLabels(nodeCopy, c.roleLabels, c.includeAlphaLabel, c.excludeLoadBalancing, c.excludeEviction, spot, c.controlPlaneLegacyLabel)
+			}, "Mark master node")
+		}
+	case RoleWorker:
+		if !isAlreadyMarkedWorkerNode(node, c.roleLabels) {
+			spot, err := isSpot()
+			if err != nil {
+				return nil, err
+			}
+			changes.apply(nodeCopy, func() { addWorkerLabels(nodeCopy, c.roleLabels, spot) }, "Mark worker node")
+		}
+	default:
+		if !hasLabels(node, c.roleLabels.primary(primary)) {
+			changes.apply(nodeCopy, func() { addLabels(nodeCopy, c.roleLabels.primary(primary)) }, "Mark node with primary role %s", primary)
+		}
+	}
+
+	for _, role := range c.rolePrecedence {
+		if role == primary {
+			continue
+		}
+		for _, variant := range roleVariants(role) {
+			changes.apply(nodeCopy, func() { removeRoleLabels(nodeCopy, c.roleLabels, variant) }, "Remove role %s in favor of primary role %s", variant, primary)
+		}
+	}
+
+	return changes, nil
+}
+
+// roleVariants returns all roles written for role, i.e. its spot and legacy variants.
+func roleVariants(role string) []string {
+	switch role {
+	case RoleControlPlane:
+		return []string{RoleControlPlane, RoleSpotControlPlane, RoleMaster, RoleSpotMaster}
+	case RoleWorker:
+		return []string{RoleWorker, RoleSpotWorker}
+	}
+	return []string{role}
+}
+
+// removeRoleLabels removes the primary and secondary labels of role from node.
+func removeRoleLabels(node *v1.Node, roles RoleLabels, role string) bool {
+	removed := false
+	for _, labels := range []map[string]string{roles.primary(role), roles.secondary(role)} {
+		for k, v := range labels {
+			if current, ok := node.Labels[k]; ok && current == v {
+				delete(node.Labels, k)
+				removed = true
+			}
+		}
+	}
+	return removed
+}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseRolePrecedence(t *testing.T) {
+	roles, err := ParseRolePrecedence("control-plane, gpu ,worker")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"control-plane", "gpu", "worker"}, roles)
+
+	roles, err = ParseRolePrecedence("")
+	assert.NoError(t, err)
+	assert.Nil(t, roles)
+
+	for _, precedence := range []string{"control-plane,,worker", "worker,worker"} {
+		_, err := ParseRolePrecedence(precedence)
+		assert.Errorf(t, err, "Expected error for precedence %q", precedence)
+	}
+}
+
+func TestHandlerShouldSwitchPrimaryRole(t *testing.T) {
+	formerWorkerControlPlaneNode := ControlPlaneNode.DeepCopy()
+	formerWorkerControlPlaneNode.Labels = map[string]string{
+		NodeRoleWorkerLabel:          "",
+		NodeKarpenterManagedLabelKey: "some-pool",
+	}
+
+	gpuWorkerNode := WorkerNode.DeepCopy()
+	gpuWorkerNode.Labels = map[string]string{
+		"customLabel":       "gpu",
+		NodeRoleWorkerLabel: "",
+	}
+
+	gpuControlPlaneNode := ControlPlaneNode.DeepCopy()
+	gpuControlPlaneNode.Labels = map[string]string{
+		"customLabel":                 "gpu",
+		"node-role.kubernetes.io/gpu": "",
+	}
+
+	testCases := []struct {
+		name           string
+		precedence     []string
+		roleLabels     RoleLabels
+		node           *v1.Node
+		expectedLabels map[string]string
+	}{
+		{
+			name:       "worker replaced by control-plane, karpenter stays additive",
+			precedence: []string{RoleControlPlane, RoleWorker},
+			node:       formerWorkerControlPlaneNode,
+			expectedLabels: map[string]string{
+				NodeKarpenterManagedLabelKey: "some-pool",
+				NodeRoleControlPlaneLabel:    "",
+				NodeKarpenterLabel:           "",
+			},
+		},
+		{
+			name:       "custom role takes precedence over worker",
+			precedence: []string{RoleControlPlane, "gpu", RoleWorker},
+			node:       gpuWorkerNode,
+			expectedLabels: map[string]string{
+				"customLabel":                 "gpu",
+				"node-role.kubernetes.io/gpu": "",
+			},
+		},
+		{
+			name:       "control-plane takes precedence over custom role",
+			precedence: []string{RoleControlPlane, "gpu", RoleWorker},
+			node:       gpuControlPlaneNode,
+			expectedLabels: map[string]string{
+				"customLabel":             "gpu",
+				NodeRoleControlPlaneLabel: "",
+			},
+		},
+		{
+			name:       "value style switches the role key",
+			precedence: []string{RoleControlPlane, RoleWorker},
+			roleLabels: RoleLabels{Style: RoleLabelStyleValue},
+			node:       formerWorkerControlPlaneNode,
+			expectedLabels: map[string]string{
+				NodeKarpenterManagedLabelKey: "some-pool",
+				"node.kubernetes.io/role":    "control-plane",
+				NodeKarpenterLabel:           "",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tc.node)
+			testingMockDiscovery := TestingMockDiscovery{}
+			c := NewNodeController(clientset, testingMockDiscovery, Config{
+				ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel),
+				CustomRoleSources:    []CustomRoleSource{{Label: "customLabel"}},
+				KarpenterEnabled:     true,
+				RoleLabels:           tc.roleLabels,
+				RolePrecedence:       tc.precedence,
+			})
+			c.handler(tc.node)
+
+			foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), tc.node.Name, metav1.GetOptions{})
+			assert.Equal(t, tc.expectedLabels, foundNode.Labels)
+		})
+	}
+}
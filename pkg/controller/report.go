@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Report summarizes the labels of all cached nodes. Nodes are only judged by
+// their current labels, so it shows drift caused by other tools without
+// asking the spot provider.
+type Report struct {
+	Time  time.Time `json:"time"`
+	Nodes int       `json:"nodes"`
+	// Ignored counts nodes carrying the ignore annotation or owned by another shard.
+	Ignored  int            `json:"ignored"`
+	Roles    map[string]int `json:"roles"`
+	Spot     int            `json:"spot"`
+	OnDemand int            `json:"onDemand"`
+	// Unlabeled lists initialized nodes without any primary role label.
+	Unlabeled     []string `json:"unlabeled"`
+	Uninitialized []string `json:"uninitialized"`
+	// ConflictingRoles lists nodes carrying more than one primary role.
+	ConflictingRoles []string `json:"conflictingRoles"`
+}
+
+// Report walks the informer cache and summarizes the node labels.
+func (c NodeController) Report() Report {
+	report := Report{
+		Time:             time.Now(),
+		Roles:            make(map[string]int),
+		Unlabeled:        []string{},
+		Uninitialized:    []string{},
+		ConflictingRoles: []string{},
+	}
+
+	for _, obj := range c.store.List() {
+		node, ok := nodeFromObject(obj)
+		if !ok {
+			continue
+		}
+		report.Nodes++
+		if !c.isNodeManaged(node) || !c.shards.Owns(node.Name) {
+			report.Ignored++
+			continue
+		}
+		if !c.isNodeInitialized(node) {
+			report.Uninitialized = append(report.Uninitialized, node.Name)
+			continue
+		}
+
+		var primaryRoles []string
+		for _, role := range c.rolesOf(node) {
+			report.Roles[role]++
+			if c.isPrimaryRole(role) {
+				primaryRoles = append(primaryRoles, role)
+			}
+		}
+
+		switch {
+		case len(primaryRoles) == 0:
+			report.Unlabeled = append(report.Unlabeled, node.Name)
+		case len(primaryRoles) > 1:
+			report.ConflictingRoles = append(report.ConflictingRoles, node.Name)
+		}
+		if slices.Contains(primaryRoles, RoleSpotWorker) || slices.Contains(primaryRoles, RoleSpotControlPlane) {
+			report.Spot++
+		} else if slices.Contains(primaryRoles, RoleWorker) || slices.Contains(primaryRoles, RoleControlPlane) {
+			report.OnDemand++
+		}
+	}
+
+	sort.Strings(report.Unlabeled)
+	sort.Strings(report.Uninitialized)
+	sort.Strings(report.ConflictingRoles)
+	return report
+}
+
+// rolesOf returns the roles a node is labeled with in any style.
+func (c NodeController) rolesOf(node *v1.Node) []string {
+	var roles []string
+	for k, v := range node.Labels {
+		role := ""
+		if strings.HasPrefix(k, c.roleLabels.Prefix) {
+			role = strings.TrimPrefix(k, c.roleLabels.Prefix)
+		} else if k == c.roleLabels.Key {
+			role = v
+		}
+		if role != "" && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// isPrimaryRole reports whether a node should only carry one role like it.
+func (c NodeController) isPrimaryRole(role string) bool {
+	switch role {
+	case RoleWorker, RoleSpotWorker, RoleControlPlane, RoleSpotControlPlane:
+		return true
+	}
+	return c.isExclusiveRole(role)
+}
+
+// Reporter periodically builds a Report, logs it and exposes it as metrics
+// and over HTTP.
+type Reporter struct {
+	controller NodeController
+
+	mu     sync.RWMutex
+	report *Report
+
+	nodes            prometheus.Gauge
+	ignored          prometheus.Gauge
+	roles            *prometheus.GaugeVec
+	spot             prometheus.Gauge
+	onDemand         prometheus.Gauge
+	unlabeled        prometheus.Gauge
+	uninitialized    prometheus.Gauge
+	conflictingRoles prometheus.Gauge
+	lastReport       prometheus.Gauge
+}
+
+// NewReporter returns a reporter for the controller and registers its metrics.
+func NewReporter(controller NodeController, registerer prometheus.Registerer) *Reporter {
+	gauge := func(name string, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{Namespace: "k8s_node_label", Name: name, Help: help})
+	}
+	r := &Reporter{
+		controller:       controller,
+		nodes:            gauge("nodes", "Number of cached nodes"),
+		ignored:          gauge("ignored_nodes", "Number of cached nodes not managed by this replica"),
+		spot:             gauge("spot_nodes", "Number of nodes labeled as spot"),
+		onDemand:         gauge("on_demand_nodes", "Number of nodes labeled as on-demand"),
+		unlabeled:        gauge("unlabeled_nodes", "Number of initialized nodes without a primary role"),
+		uninitialized:    gauge("uninitialized_nodes", "Number of nodes not yet initialized by the cloud controller"),
+		conflictingRoles: gauge("conflicting_role_nodes", "Number of nodes with more than one primary role"),
+		lastReport:       gauge("last_report_timestamp_seconds", "Unix time of the last reconciliation report"),
+		roles: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "k8s_node_label",
+			Name:      "role_nodes",
+			Help:      "Number of nodes labeled with a role",
+		}, []string{"role"}),
+	}
+	registerer.MustRegister(r.nodes, r.ignored, r.roles, r.spot, r.onDemand, r.unlabeled, r.uninitialized, r.conflictingRoles, r.lastReport)
+	return r
+}
+
+// Run reports every interval once the informer cache is synced, until stopCh is closed.
+func (r *Reporter) Run(interval time.Duration, stopCh <-chan struct{}) {
+	if !cache.WaitForCacheSync(stopCh, r.controller.Controller.HasSynced) {
+		return
+	}
+	wait.Until(r.reconcile, interval, stopCh)
+}
+
+func (r *Reporter) reconcile() {
+	report := r.controller.Report()
+
+	r.mu.Lock()
+	r.report = &report
+	r.mu.Unlock()
+
+	r.nodes.Set(float64(report.Nodes))
+	r.ignored.Set(float64(report.Ignored))
+	r.spot.Set(float64(report.Spot))
+	r.onDemand.Set(float64(report.OnDemand))
+	r.unlabeled.Set(float64(len(report.Unlabeled)))
+	r.uninitialized.Set(float64(len(report.Uninitialized)))
+	r.conflictingRoles.Set(float64(len(report.ConflictingRoles)))
+	r.lastReport.Set(float64(report.Time.Unix()))
+	r.roles.Reset()
+	for role, count := range report.Roles {
+		r.roles.WithLabelValues(role).Set(float64(count))
+	}
+
+	fields := log.Fields{
+		"nodes":             report.Nodes,
+		"ignored":           report.Ignored,
+		"spot":              report.Spot,
+		"on_demand":         report.OnDemand,
+		"unlabeled":         len(report.Unlabeled),
+		"uninitialized":     len(report.Uninitialized),
+		"conflicting_roles": len(report.ConflictingRoles),
+	}
+	for role, count := range report.Roles {
+		fields["role_"+role] = count
+	}
+	log.WithFields(fields).Info("Reconciliation report")
+}
+
+// ServeHTTP returns the last report as JSON.
+func (r *Reporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.RLock()
+	report := r.report
+	r.mu.RUnlock()
+
+	if report == nil {
+		http.Error(w, "no report available yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Errorf("Failed to write reconciliation report: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func reportNode(name string, labels map[string]string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestReport(t *testing.T) {
+	uninitialized := reportNode("uninitialized", nil)
+	uninitialized.Spec.Taints = []v1.Taint{{Key: NodeUninitialziedTaint}}
+	ignored := reportNode("ignored", nil)
+	ignored.Annotations = map[string]string{IgnoreNodeKey: "true"}
+
+	c := NewNodeController(fake.NewSimpleClientset(), TestingMockDiscovery{}, Config{})
+	for _, node := range []*v1.Node{
+		reportNode("worker", map[string]string{NodeRoleWorkerLabel: ""}),
+		reportNode("spot-worker", map[string]string{NodeRoleSpotWorkerLabel: "", "node-role.kubernetes.io/gpu": ""}),
+		reportNode("control-plane", map[string]string{NodeRoleControlPlaneLabel: "", NodeRoleMasterLabel: ""}),
+		reportNode("conflicting", map[string]string{NodeRoleWorkerLabel: "", NodeRoleControlPlaneLabel: ""}),
+		reportNode("unlabeled", map[string]string{"node-role.kubernetes.io/gpu": ""}),
+		uninitialized,
+		ignored,
+	} {
+		c.store.Add(node)
+	}
+
+	report := c.Report()
+	assert.Equal(t, 7, report.Nodes)
+	assert.Equal(t, 1, report.Ignored)
+	assert.Equal(t, map[string]int{
+		RoleWorker:       2,
+		RoleSpotWorker:   1,
+		RoleControlPlane: 2,
+		RoleMaster:       1,
+		"gpu":            2,
+	}, report.Roles)
+	assert.Equal(t, 1, report.Spot)
+	assert.Equal(t, 3, report.OnDemand)
+	assert.Equal(t, []string{"unlabeled"}, report.Unlabeled)
+	assert.Equal(t, []string{"uninitialized"}, report.Uninitialized)
+	assert.Equal(t, []string{"conflicting"}, report.ConflictingRoles)
+}
+
+func TestReportShouldReadValueStyleRoles(t *testing.T) {
+	c := NewNodeController(fake.NewSimpleClientset(), TestingMockDiscovery{}, Config{RoleLabels: RoleLabels{Style: RoleLabelStyleValue}})
+	c.store.Add(reportNode("worker", map[string]string{DefaultRoleLabelKey: RoleSpotWorker}))
+
+	report := c.Report()
+	assert.Equal(t, map[string]int{RoleSpotWorker: 1}, report.Roles)
+	assert.Equal(t, 1, report.Spot)
+	assert.Empty(t, report.Unlabeled)
+}
+
+func TestReporterShouldExposeMetricsAndReport(t *testing.T) {
+	c := NewNodeController(fake.NewSimpleClientset(), TestingMockDiscovery{}, Config{})
+	c.store.Add(reportNode("worker", map[string]string{NodeRoleWorkerLabel: ""}))
+	c.store.Add(reportNode("unlabeled", nil))
+
+	registry := prometheus.NewRegistry()
+	reporter := NewReporter(c, registry)
+
+	recorder := httptest.NewRecorder()
+	reporter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/report", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	reporter.reconcile()
+	entry := hook.LastEntry()
+	assert.Equal(t, "Reconciliation report", entry.Message)
+	assert.Equal(t, 2, entry.Data["nodes"])
+	assert.Equal(t, 1, entry.Data["unlabeled"])
+	assert.Equal(t, 1, entry.Data["role_"+RoleWorker])
+	assert.Equal(t, float64(2), testutil.ToFloat64(reporter.nodes))
+	assert.Equal(t, float64(1), testutil.ToFloat64(reporter.unlabeled))
+	assert.Equal(t, float64(1), testutil.ToFloat64(reporter.roles.WithLabelValues(RoleWorker)))
+
+	recorder = httptest.NewRecorder()
+	reporter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/report", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var report Report
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, []string{"unlabeled"}, report.Unlabeled)
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// RoleLabelStyle selects how roles are written to a node.
+type RoleLabelStyle string
+
+const (
+	// RoleLabelStylePrefix writes prefix keyed labels with an empty value, e.g. node-role.kubernetes.io/worker="".
+	RoleLabelStylePrefix RoleLabelStyle = "prefix"
+	// RoleLabelStyleValue writes the role as value of a single key, e.g. node.kubernetes.io/role=worker.
+	RoleLabelStyleValue RoleLabelStyle = "value"
+	// RoleLabelStyleBoth writes both styles.
+	RoleLabelStyleBoth RoleLabelStyle = "both"
+
+	DefaultRoleLabelPrefix = "node-role.kubernetes.io/"
+	DefaultRoleLabelKey    = "node.kubernetes.io/role"
+)
+
+const (
+	RoleWorker           = "worker"
+	RoleSpotWorker       = "spot-worker"
+	RoleControlPlane     = "control-plane"
+	RoleSpotControlPlane = "spot-control-plane"
+	RoleMaster           = "master"
+	RoleSpotMaster       = "spot-master"
+	RoleKarpenter        = "karpenter"
+)
+
+// RoleLabels turns role names into node labels.
+//
+// The primary role of a node (worker, control-plane and their spot variants)
+// is written in the configured style. All other roles are additive and a single
+// key can only hold one value, so they are always written prefix keyed.
+type RoleLabels struct {
+	Style  RoleLabelStyle
+	Prefix string
+	Key    string
+}
+
+// ParseRoleLabelStyle validates the name of a role label style.
+func ParseRoleLabelStyle(style string) (RoleLabelStyle, error) {
+	switch s := RoleLabelStyle(style); s {
+	case RoleLabelStylePrefix, RoleLabelStyleValue, RoleLabelStyleBoth:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown role label style %q, available values: (prefix, value, both)", style)
+}
+
+// Validate checks that the prefix and key result in valid label keys. The
+// prefix has to end with "/", otherwise roles would be glued to its name.
+func (r RoleLabels) Validate() error {
+	if r.Prefix != "" {
+		if !strings.HasSuffix(r.Prefix, "/") {
+			return fmt.Errorf("role label prefix %q must end with \"/\"", r.Prefix)
+		}
+		if errs := validation.IsQualifiedName(r.prefixed(RoleSpotControlPlane)); len(errs) > 0 {
+			return fmt.Errorf("role label prefix %q doesn't result in valid label keys: %s", r.Prefix, strings.Join(errs, "; "))
+		}
+	}
+	if r.Key != "" {
+		if errs := validation.IsQualifiedName(r.Key); len(errs) > 0 {
+			return fmt.Errorf("role label key %q isn't a valid label key: %s", r.Key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// withDefaults fills unset fields with the upstream node-role conventions.
+func (r RoleLabels) withDefaults() RoleLabels {
+	if r.Style == "" {
+		r.Style = RoleLabelStylePrefix
+	}
+	if r.Prefix == "" {
+		r.Prefix = DefaultRoleLabelPrefix
+	}
+	if r.Key == "" {
+		r.Key = DefaultRoleLabelKey
+	}
+	return r
+}
+
+// prefixed returns the prefix keyed label key of a role.
+func (r RoleLabels) prefixed(role string) string {
+	return r.Prefix + role
+}
+
+// primary returns the labels marking role as primary role of a node.
+func (r RoleLabels) primary(role string) map[string]string {
+	labels := make(map[string]string)
+	if r.Style == RoleLabelStylePrefix || r.Style == RoleLabelStyleBoth {
+		labels[r.prefixed(role)] = ""
+	}
+	if r.Style == RoleLabelStyleValue || r.Style == RoleLabelStyleBoth {
+		labels[r.Key] = role
+	}
+	return labels
+}
+
+// secondary returns the labels of an additive role.
+func (r RoleLabels) secondary(role string) map[string]string {
+	return map[string]string{r.prefixed(role): ""}
+}
+
+func hasLabels(node *v1.Node, labels map[string]string) bool {
+	for k, v := range labels {
+		if current, ok := node.Labels[k]; !ok || current != v {
+			return false
+		}
+	}
+	return true
+}
+
+func addLabels(node *v1.Node, labels map[string]string) {
+	for k, v := range labels {
+		node.Labels[k] = v
+	}
+}
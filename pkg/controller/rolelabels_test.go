@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseRoleLabelStyle(t *testing.T) {
+	style, err := ParseRoleLabelStyle("both")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleLabelStyleBoth, style)
+
+	_, err = ParseRoleLabelStyle("suffix")
+	assert.Error(t, err)
+}
+
+func TestRoleLabelsValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		roleLabels  RoleLabels
+		expectedErr string
+	}{
+		{
+			name:       "defaults",
+			roleLabels: RoleLabels{Prefix: DefaultRoleLabelPrefix, Key: DefaultRoleLabelKey},
+		},
+		{
+			name:       "unset",
+			roleLabels: RoleLabels{},
+		},
+		{
+			name:        "prefix without slash",
+			roleLabels:  RoleLabels{Prefix: "node-role.kubernetes.io"},
+			expectedErr: `role label prefix "node-role.kubernetes.io" must end with "/"`,
+		},
+		{
+			name:        "invalid prefix",
+			roleLabels:  RoleLabels{Prefix: "example com/"},
+			expectedErr: `role label prefix "example com/" doesn't result in valid label keys`,
+		},
+		{
+			name:        "invalid key",
+			roleLabels:  RoleLabels{Key: "example.com/role/name"},
+			expectedErr: `role label key "example.com/role/name" isn't a valid label key`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.roleLabels.Validate()
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestHandlerShouldApplyRoleLabelStyle(t *testing.T) {
+	karpenterControlPlaneNode := ControlPlaneNode.DeepCopy()
+	karpenterControlPlaneNode.Labels = map[string]string{
+		NodeKarpenterManagedLabelKey: "some-pool",
+		"customLabel":                "ingress",
+	}
+
+	testCases := []struct {
+		name           string
+		roleLabels     RoleLabels
+		node           *v1.Node
+		expectedLabels map[string]string
+	}{
+		{
+			name:       "value style for spot worker",
+			roleLabels: RoleLabels{Style: RoleLabelStyleValue},
+			node:       SpotWorkerNode,
+			expectedLabels: map[string]string{
+				"node.kubernetes.io/role": "spot-worker",
+			},
+		},
+		{
+			name:       "both styles with custom key for worker",
+			roleLabels: RoleLabels{Style: RoleLabelStyleBoth, Key: "kubernetes.io/role"},
+			node:       WorkerNode,
+			expectedLabels: map[string]string{
+				"kubernetes.io/role":             "worker",
+				"node-role.kubernetes.io/worker": "",
+			},
+		},
+		{
+			name:       "custom prefix for all roles",
+			roleLabels: RoleLabels{Style: RoleLabelStyleValue, Prefix: "roles.example.com/"},
+			node:       karpenterControlPlaneNode,
+			expectedLabels: map[string]string{
+				NodeKarpenterManagedLabelKey:  "some-pool",
+				"customLabel":                 "ingress",
+				"node.kubernetes.io/role":     "control-plane",
+				"roles.example.com/master":    "",
+				"roles.example.com/karpenter": "",
+				"roles.example.com/ingress":   "",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tc.node)
+			testingMockDiscovery := TestingMockDiscovery{}
+			c := NewNodeController(clientset, testingMockDiscovery, Config{
+				ControlPlaneDetector:    controlplane.NewTaintDetector(NodeRoleControlPlaneLabel),
+				ControlPlaneLegacyLabel: true,
+				KarpenterEnabled:        true,
+				CustomRoleSources:       []CustomRoleSource{{Label: "customLabel"}},
+				RoleLabels:              tc.roleLabels,
+			})
+			c.handler(tc.node)
+
+			foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), tc.node.Name, metav1.GetOptions{})
+			assert.Equal(t, tc.expectedLabels, foundNode.Labels)
+		})
+	}
+}
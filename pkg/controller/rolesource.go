@@ -0,0 +1,35 @@
+package controller
+
+import v1 "k8s.io/api/core/v1"
+
+// roleSource is a role a node gets from the group it belongs to, e.g. its
+// Karpenter nodepool. The role is empty if the node has none.
+type roleSource struct {
+	// name describes the source in log messages and explanations.
+	name string
+	// enabled is set if the source is configured.
+	enabled bool
+	role    string
+}
+
+// roleSources returns the roles node gets from its Karpenter nodepool,
+// Cluster API machine pool and managed node group.
+func (c NodeController) roleSources(node *v1.Node) []roleSource {
+	_, nodeGroupRole, _ := c.nodeGroup(node)
+	return []roleSource{
+		{name: "karpenter nodepool", enabled: c.karpenterEnabled && c.karpenterNodePoolRoles, role: c.karpenterNodePoolRole(node)},
+		{name: "machine pool", enabled: c.machines != nil, role: c.machinePoolRole(node)},
+		{name: "node group", enabled: len(c.nodeGroupMappers) > 0, role: nodeGroupRole},
+	}
+}
+
+// sourceRoles returns the non-empty roles of sources.
+func sourceRoles(sources []roleSource) []string {
+	var roles []string
+	for _, source := range sources {
+		if source.role != "" {
+			roles = append(roles, source.role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+// Shards tracks which node shards this replica currently owns. Node names are
+// hashed into a fixed number of shards, each guarded by its own lease, so a
+// node is only ever written by the replica holding its shard.
+//
+// A nil *Shards owns all nodes.
+type Shards struct {
+	count int
+	mu    sync.RWMutex
+	owned map[int]bool
+}
+
+// NewShards returns a shard set of count shards with none of them owned.
+func NewShards(count int) *Shards {
+	return &Shards{
+		count: count,
+		owned: make(map[int]bool),
+	}
+}
+
+// Count returns the total number of shards.
+func (s *Shards) Count() int {
+	return s.count
+}
+
+// ShardOf returns the shard a node name belongs to.
+func (s *Shards) ShardOf(nodeName string) int {
+	h := fnv.New32a()
+	h.Write([]byte(nodeName))
+	return int(h.Sum32() % uint32(s.count))
+}
+
+// TryAcquire marks shard as owned unless max shards are already owned.
+// A max of 0 doesn't limit the number of owned shards.
+func (s *Shards) TryAcquire(shard int, max int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if max > 0 && len(s.owned) >= max && !s.owned[shard] {
+		return false
+	}
+	s.owned[shard] = true
+	return true
+}
+
+// Release marks shard as no longer owned.
+func (s *Shards) Release(shard int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.owned, shard)
+}
+
+// Owns reports whether the shard of nodeName is owned by this replica.
+func (s *Shards) Owns(nodeName string) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.owned[s.ShardOf(nodeName)]
+}
+
+// ProcessShard labels all cached nodes of a shard. It's called after this
+// replica took over a shard, so its nodes don't wait for the next resync.
+// It stops early once ctx, the context of the shard lease, is cancelled.
+func (c NodeController) ProcessShard(ctx context.Context, shard int) {
+	if c.shards == nil {
+		return
+	}
+	for _, obj := range c.store.List() {
+		if ctx.Err() != nil {
+			return
+		}
+		if node, ok := nodeFromObject(obj); ok && c.shards.ShardOf(node.Name) == shard {
+			c.handler(obj)
+		}
+	}
+}
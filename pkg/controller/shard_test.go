@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestShardOfIsStableAndSpread(t *testing.T) {
+	shards := NewShards(4)
+	assert.Equal(t, shards.ShardOf("node-a"), shards.ShardOf("node-a"))
+
+	counts := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		counts[shards.ShardOf(fmt.Sprintf("ip-10-0-%d-%d.eu-central-1.compute.internal", i/256, i%256))]++
+	}
+	assert.Len(t, counts, 4)
+	for shard, count := range counts {
+		assert.Greaterf(t, count, 150, "Expected shard %d to hold a fair share of nodes", shard)
+	}
+}
+
+func TestShardsTryAcquireRespectsMax(t *testing.T) {
+	shards := NewShards(4)
+	assert.True(t, shards.TryAcquire(0, 2))
+	assert.True(t, shards.TryAcquire(1, 2))
+	assert.True(t, shards.TryAcquire(1, 2))
+	assert.False(t, shards.TryAcquire(2, 2))
+
+	shards.Release(0)
+	assert.True(t, shards.TryAcquire(2, 2))
+
+	assert.True(t, shards.TryAcquire(3, 0))
+}
+
+func TestShardsOwns(t *testing.T) {
+	var unsharded *Shards
+	assert.True(t, unsharded.Owns("node-a"))
+
+	shards := NewShards(2)
+	assert.False(t, shards.Owns("node-a"))
+	shards.TryAcquire(shards.ShardOf("node-a"), 0)
+	assert.True(t, shards.Owns("node-a"))
+}
+
+func TestHandlerShouldOnlyMarkNodesOfOwnedShards(t *testing.T) {
+	shards := NewShards(2)
+	clientset := fake.NewSimpleClientset(WorkerNode)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{Shards: shards})
+
+	c.handler(WorkerNode)
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), WorkerNode.Name, metav1.GetOptions{})
+	assert.NotContains(t, foundNode.Labels, NodeRoleWorkerLabel)
+
+	shard := shards.ShardOf(WorkerNode.Name)
+	shards.TryAcquire(shard, 0)
+	c.store.Add(WorkerNode)
+	c.ProcessShard(context.TODO(), shard)
+	foundNode, _ = clientset.CoreV1().Nodes().Get(context.TODO(), WorkerNode.Name, metav1.GetOptions{})
+	assert.Contains(t, foundNode.Labels, NodeRoleWorkerLabel)
+}
+
+func TestProcessShardShouldSkipOtherShards(t *testing.T) {
+	shards := NewShards(2)
+	clientset := fake.NewSimpleClientset(WorkerNode)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{Shards: shards})
+
+	shard := shards.ShardOf(WorkerNode.Name)
+	other := (shard + 1) % 2
+	shards.TryAcquire(other, 0)
+	c.store.Add(WorkerNode.DeepCopy())
+	c.ProcessShard(context.TODO(), other)
+
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), WorkerNode.Name, metav1.GetOptions{})
+	assert.NotContains(t, foundNode.Labels, NodeRoleWorkerLabel)
+}
+
+func TestProcessShardShouldStopOnCancel(t *testing.T) {
+	shards := NewShards(2)
+	clientset := fake.NewSimpleClientset(WorkerNode)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{Shards: shards})
+
+	shard := shards.ShardOf(WorkerNode.Name)
+	shards.TryAcquire(shard, 0)
+	c.store.Add(WorkerNode.DeepCopy())
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	c.ProcessShard(ctx, shard)
+
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), WorkerNode.Name, metav1.GetOptions{})
+	assert.NotContains(t, foundNode.Labels, NodeRoleWorkerLabel)
+}
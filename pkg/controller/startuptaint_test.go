@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+type failingDiscovery struct{}
+
+func (failingDiscovery) IsSpotInstance(logger log.FieldLogger, node *v1.Node) (bool, error) {
+	return false, errors.New("throttled")
+}
+
+const testStartupTaint = "k8s-node-label.io/not-labeled"
+
+func TestHandlerShouldRemoveStartupTaintWithLabels(t *testing.T) {
+	node := WorkerNode.DeepCopy()
+	node.Spec.Taints = []v1.Taint{
+		{Key: testStartupTaint, Effect: v1.TaintEffectNoSchedule},
+		{Key: "example.com/dedicated", Effect: v1.TaintEffectNoSchedule},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{StartupTaint: testStartupTaint})
+
+	c.handler(node)
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Contains(t, foundNode.Labels, NodeRoleWorkerLabel)
+	assert.Equal(t, []v1.Taint{{Key: "example.com/dedicated", Effect: v1.TaintEffectNoSchedule}}, foundNode.Spec.Taints)
+}
+
+func TestHandlerShouldRemoveStartupTaintFromLabeledNode(t *testing.T) {
+	node := WorkerNode.DeepCopy()
+	node.Labels = map[string]string{NodeRoleWorkerLabel: ""}
+	node.Spec.Taints = []v1.Taint{{Key: testStartupTaint, Effect: v1.TaintEffectNoSchedule}}
+	clientset := fake.NewSimpleClientset(node)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{StartupTaint: testStartupTaint})
+
+	c.handler(node)
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Empty(t, foundNode.Spec.Taints)
+}
+
+func TestHandlerShouldKeepStartupTaintOfUninitializedNodes(t *testing.T) {
+	node := UninitializedNode.DeepCopy()
+	node.Spec.ProviderID = ""
+	node.Labels = map[string]string{"customLabel": "etcd"}
+	node.Spec.Taints = append(node.Spec.Taints, v1.Taint{Key: testStartupTaint, Effect: v1.TaintEffectNoSchedule})
+	clientset := fake.NewSimpleClientset(node)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{
+		StartupTaint:      testStartupTaint,
+		PreLabel:          true,
+		CustomRoleSources: []CustomRoleSource{{Label: "customLabel"}},
+	})
+
+	c.handler(node)
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Contains(t, foundNode.Labels, "node-role.kubernetes.io/etcd")
+	assert.Contains(t, foundNode.Spec.Taints, v1.Taint{Key: testStartupTaint, Effect: v1.TaintEffectNoSchedule})
+}
+
+func TestHandlerShouldKeepStartupTaintIfSpotProviderFails(t *testing.T) {
+	node := WorkerNode.DeepCopy()
+	node.Spec.Taints = []v1.Taint{{Key: testStartupTaint, Effect: v1.TaintEffectNoSchedule}}
+	clientset := fake.NewSimpleClientset(node)
+	c := NewNodeController(clientset, failingDiscovery{}, Config{StartupTaint: testStartupTaint})
+
+	c.handler(node)
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.NotContains(t, foundNode.Labels, NodeRoleWorkerLabel)
+	assert.Contains(t, foundNode.Spec.Taints, v1.Taint{Key: testStartupTaint, Effect: v1.TaintEffectNoSchedule})
+	assert.Equal(t, 1, c.uninitialized.Len())
+
+	// the queue worker retries once the provider answers
+	c.spotInstanceDiscovery = TestingMockDiscovery{}
+	c.store.Add(foundNode)
+	assert.True(t, c.processUninitialized())
+	foundNode, _ = clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Contains(t, foundNode.Labels, NodeRoleWorkerLabel)
+	assert.Empty(t, foundNode.Spec.Taints)
+	assert.Equal(t, 0, c.uninitialized.NumRequeues(node.Name))
+}
+
+func TestHandlerShouldKeepStartupTaintUntilRoleSourcesResolve(t *testing.T) {
+	karpenterNode := WorkerNode.DeepCopy()
+	karpenterNode.Spec.Taints = []v1.Taint{{Key: NodeKarpenterUnregistered, Effect: v1.TaintEffectNoExecute}}
+
+	testCases := []struct {
+		name   string
+		config Config
+		node   *v1.Node
+	}{
+		{
+			name:   "machine not cached",
+			config: Config{Machines: testingMachines{}},
+			node:   WorkerNode,
+		},
+		{
+			name:   "nodeclaim not cached",
+			config: Config{KarpenterEnabled: true, NodeClaims: testingNodeClaims{}},
+			node:   karpenterNode,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node := tc.node.DeepCopy()
+			node.Spec.Taints = append(node.Spec.Taints, v1.Taint{Key: testStartupTaint, Effect: v1.TaintEffectNoSchedule})
+			clientset := fake.NewSimpleClientset(node)
+			tc.config.StartupTaint = testStartupTaint
+			c := NewNodeController(clientset, TestingMockDiscovery{}, tc.config)
+
+			c.handler(node)
+			foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+			assert.Contains(t, foundNode.Spec.Taints, v1.Taint{Key: testStartupTaint, Effect: v1.TaintEffectNoSchedule})
+			assert.Equal(t, 1, c.uninitialized.Len())
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHandlerShouldRecordSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	clientset := fake.NewSimpleClientset(SpotWorkerNode)
+	logger, hook := logtest.NewNullLogger()
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{})
+	c.logger = logger
+	c.handler(SpotWorkerNode)
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	assert.Equal(t, []string{"spotdiscovery.IsSpotInstance", "updateNode", "markNode", "handler"}, names)
+
+	handlerSpan := recorder.Ended()[3]
+	for _, span := range recorder.Ended() {
+		assert.Equal(t, handlerSpan.SpanContext().TraceID(), span.SpanContext().TraceID())
+	}
+	assert.Equal(t, handlerSpan.SpanContext().TraceID().String(), hook.LastEntry().Data["trace_id"])
+}
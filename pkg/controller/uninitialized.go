@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"slices"
+	"time"
+
+	"github.com/daspawnw/k8s-node-label/pkg/spotdiscovery"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	uninitializedBaseDelay = time.Second
+	uninitializedMaxDelay  = 2 * time.Minute
+)
+
+func newUninitializedQueue() workqueue.TypedRateLimitingInterface[string] {
+	return workqueue.NewTypedRateLimitingQueueWithConfig(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[string](uninitializedBaseDelay, uninitializedMaxDelay),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: "uninitialized-nodes"},
+	)
+}
+
+// isNodeInitialized reports whether none of the wait-for taints is left on the node.
+func (c NodeController) isNodeInitialized(node *v1.Node) bool {
+	for i := range node.Spec.Taints {
+		if slices.Contains(c.waitForTaints, node.Spec.Taints[i].Key) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeTaint removes all taints with key from node and reports whether one was found.
+func removeTaint(node *v1.Node, key string) bool {
+	taints := slices.DeleteFunc(node.Spec.Taints, func(t v1.Taint) bool {
+		return t.Key == key
+	})
+	removed := len(taints) != len(node.Spec.Taints)
+	node.Spec.Taints = taints
+	return removed
+}
+
+// isSpotKnown reports whether the spot provider can already answer for a
+// node. It needs the instance from the provider ID, which may only be set
+// once the cloud controller initialized the node. Nodes whose spot state
+// is known from Karpenter or managed node group labels don't need the provider.
+func (c NodeController) isSpotKnown(node *v1.Node) bool {
+	if _, ok := c.spotInstanceDiscovery.(spotdiscovery.FalseSpotDiscovery); ok {
+		return true
+	}
+	if _, _, ok := c.labeledSpot(node); ok {
+		return true
+	}
+	return node.Spec.ProviderID != ""
+}
+
+// runUninitializedQueue processes queued uninitialized nodes until stopCh is
+// closed. It returns once the node being processed is done.
+func (c NodeController) runUninitializedQueue(stopCh <-chan struct{}) {
+	go func() {
+		<-stopCh
+		c.uninitialized.ShutDown()
+	}()
+	for c.processUninitialized() {
+	}
+}
+
+func (c NodeController) processUninitialized() bool {
+	name, shutdown := c.uninitialized.Get()
+	if shutdown {
+		return false
+	}
+	defer c.uninitialized.Done(name)
+
+	obj, exists, err := c.store.GetByKey(name)
+	if err != nil || !exists {
+		// the node is gone or no longer selected
+		c.uninitialized.Forget(name)
+		return true
+	}
+	c.reconcileNode(obj, true)
+	return true
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/daspawnw/k8s-node-label/pkg/spotdiscovery"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHandlerShouldRequeueUninitializedNodes(t *testing.T) {
+	node := UninitializedNode.DeepCopy()
+	clientset := fake.NewSimpleClientset(node)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{})
+
+	// events only queue the node, they don't add to its backoff
+	c.handler(node)
+	c.handler(node)
+	assert.Equal(t, 1, c.uninitialized.Len())
+	assert.Equal(t, 0, c.uninitialized.NumRequeues(node.Name))
+
+	// the queue worker requeues it with backoff
+	c.store.Add(node)
+	assert.True(t, c.processUninitialized())
+	assert.Equal(t, 1, c.uninitialized.NumRequeues(node.Name))
+	c.handler(node)
+	assert.Equal(t, 1, c.uninitialized.NumRequeues(node.Name))
+
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Empty(t, foundNode.Labels)
+
+	node.Spec.Taints = node.Spec.Taints[:1]
+	c.handler(node)
+	assert.Equal(t, 0, c.uninitialized.NumRequeues(node.Name))
+
+	foundNode, _ = clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+	assert.Contains(t, foundNode.Labels, NodeRoleControlPlaneLabel)
+}
+
+func TestIsNodeInitializedWithWaitForTaints(t *testing.T) {
+	node := WorkerNode.DeepCopy()
+	node.Spec.Taints = []v1.Taint{{Key: "example.com/not-ready", Effect: v1.TaintEffectNoSchedule}}
+
+	c := NewNodeController(fake.NewSimpleClientset(), TestingMockDiscovery{}, Config{WaitForTaints: []string{"example.com/not-ready"}})
+	assert.False(t, c.isNodeInitialized(node))
+	assert.True(t, c.isNodeInitialized(UninitializedNode))
+}
+
+func TestProcessUninitializedShouldHandleCachedNode(t *testing.T) {
+	clientset := fake.NewSimpleClientset(WorkerNode)
+	c := NewNodeController(clientset, TestingMockDiscovery{}, Config{})
+	c.store.Add(WorkerNode)
+	c.uninitialized.Add(WorkerNode.Name)
+	c.uninitialized.Add("removed-node")
+
+	assert.True(t, c.processUninitialized())
+	assert.True(t, c.processUninitialized())
+
+	foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), WorkerNode.Name, metav1.GetOptions{})
+	assert.Contains(t, foundNode.Labels, NodeRoleWorkerLabel)
+
+	c.uninitialized.ShutDown()
+	assert.False(t, c.processUninitialized())
+}
+
+func TestHandlerShouldPreLabelUninitializedNodes(t *testing.T) {
+	node := UninitializedNode.DeepCopy()
+	node.Spec.ProviderID = ""
+	node.Labels = map[string]string{"customLabel": "etcd"}
+
+	testCases := []struct {
+		name           string
+		spotDiscovery  spotdiscovery.SpotDiscoveryInterface
+		expectedLabels map[string]string
+	}{
+		{
+			name:          "spot provider can't answer yet",
+			spotDiscovery: TestingMockDiscovery{},
+			expectedLabels: map[string]string{
+				"customLabel":                  "etcd",
+				"node-role.kubernetes.io/etcd": "",
+			},
+		},
+		{
+			name:          "without spot provider",
+			spotDiscovery: spotdiscovery.FalseSpotDiscovery{},
+			expectedLabels: map[string]string{
+				"customLabel":                  "etcd",
+				"node-role.kubernetes.io/etcd": "",
+				NodeRoleControlPlaneLabel:      "",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(node)
+			c := NewNodeController(clientset, tc.spotDiscovery, Config{PreLabel: true, CustomRoleSources: []CustomRoleSource{{Label: "customLabel"}}})
+			c.handler(node)
+
+			foundNode, _ := clientset.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+			assert.Equal(t, tc.expectedLabels, foundNode.Labels)
+			assert.Equal(t, 1, c.uninitialized.Len())
+		})
+	}
+}
+
+func TestRunShouldWaitForUninitializedQueue(t *testing.T) {
+	c := NewNodeController(fake.NewSimpleClientset(), TestingMockDiscovery{}, Config{})
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Run(stopCh)
+		close(done)
+	}()
+	close(stopCh)
+	<-done
+
+	assert.True(t, c.uninitialized.ShuttingDown())
+}
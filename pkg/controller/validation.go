@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// dropInvalidLabels reverts all label changes on nodeCopy the API server
+// would reject, so they can't break the update of the remaining labels.
+// It returns the reverted label keys.
+func (c NodeController) dropInvalidLabels(logger log.FieldLogger, node *v1.Node, nodeCopy *v1.Node) []string {
+	var dropped []string
+	for key, value := range nodeCopy.Labels {
+		if old, ok := node.Labels[key]; ok && old == value {
+			continue
+		}
+
+		errs := validateLabel(key, value)
+		if len(errs) == 0 {
+			continue
+		}
+
+		logger.Warnf("Skip invalid label %s=%s: %s", key, value, strings.Join(errs, "; "))
+		c.recorder.Eventf(node, v1.EventTypeWarning, EventReasonInvalidLabel, "Skip invalid label %s=%s: %s", key, value, strings.Join(errs, "; "))
+		if old, ok := node.Labels[key]; ok {
+			nodeCopy.Labels[key] = old
+		} else {
+			delete(nodeCopy.Labels, key)
+		}
+		dropped = append(dropped, key)
+	}
+
+	sort.Strings(dropped)
+	return dropped
+}
+
+func validateLabel(key string, value string) []string {
+	var errs []string
+	for _, e := range validation.IsQualifiedName(key) {
+		errs = append(errs, "key: "+e)
+	}
+	for _, e := range validation.IsValidLabelValue(value) {
+		errs = append(errs, "value: "+e)
+	}
+	return errs
+}
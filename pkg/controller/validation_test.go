@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/daspawnw/k8s-node-label/pkg/controlplane"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDropInvalidLabels(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-worker-node",
+			Labels: map[string]string{
+				"team": "ml",
+			},
+		},
+	}
+
+	testCases := []struct {
+		name            string
+		labels          map[string]string
+		expectedDropped []string
+		expectedLabels  map[string]string
+		expectedEvents  int
+	}{
+		{
+			name: "valid and invalid changes",
+			labels: map[string]string{
+				"team":                           "ml",
+				"node-role.kubernetes.io/worker": "",
+				"node-role.kubernetes.io/a,b":    "",
+				"example.com/value":              "not valid",
+			},
+			expectedDropped: []string{"example.com/value", "node-role.kubernetes.io/a,b"},
+			expectedLabels: map[string]string{
+				"team":                           "ml",
+				"node-role.kubernetes.io/worker": "",
+			},
+			expectedEvents: 2,
+		},
+		{
+			name: "invalid change of existing label",
+			labels: map[string]string{
+				"team": "m l",
+			},
+			expectedDropped: []string{"team"},
+			expectedLabels: map[string]string{
+				"team": "ml",
+			},
+			expectedEvents: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			c := NewNodeController(fake.NewSimpleClientset(node), TestingMockDiscovery{}, Config{ControlPlaneDetector: controlplane.NewTaintDetector(NodeRoleControlPlaneLabel)})
+			c.recorder = recorder
+
+			nodeCopy := node.DeepCopy()
+			nodeCopy.Labels = tc.labels
+
+			assert.Equal(t, tc.expectedDropped, c.dropInvalidLabels(c.logger, node, nodeCopy))
+			assert.Equal(t, tc.expectedLabels, nodeCopy.Labels)
+			assert.Len(t, recorder.Events, tc.expectedEvents)
+		})
+	}
+}
+
+func TestDesiredNodeShouldDropReasonsOfInvalidLabels(t *testing.T) {
+	template, _ := ParseLabelTemplate(`example.com/team={{ index .Annotations "team" }}`)
+	node := WorkerNode.DeepCopy()
+	node.Annotations = map[string]string{"team": "not valid"}
+
+	c := NewNodeController(fake.NewSimpleClientset(node), TestingMockDiscovery{}, Config{LabelTemplates: []LabelTemplate{template}})
+	c.recorder = record.NewFakeRecorder(10)
+
+	nodeCopy, changes, _ := c.desiredNode(context.Background(), reconcile{logger: c.logger}, node, c.lazySpotInstance(context.Background(), c.logger, node))
+	assert.Equal(t, []string{"Mark worker node"}, changes.messages())
+	assert.Equal(t, map[string]string{NodeRoleWorkerLabel: ""}, nodeCopy.Labels)
+}
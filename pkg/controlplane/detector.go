@@ -0,0 +1,78 @@
+package controlplane
+
+import (
+	"regexp"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type Detector interface {
+	IsControlPlane(node *v1.Node) bool
+}
+
+// Any reports a node as control-plane as soon as one of its detectors does.
+type Any []Detector
+
+func (a Any) IsControlPlane(node *v1.Node) bool {
+	for _, d := range a {
+		if d.IsControlPlane(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// TaintDetector matches nodes carrying one of the taint keys.
+type TaintDetector struct {
+	Keys []string
+}
+
+func NewTaintDetector(keys ...string) TaintDetector {
+	return TaintDetector{Keys: keys}
+}
+
+func (d TaintDetector) IsControlPlane(node *v1.Node) bool {
+	for _, t := range node.Spec.Taints {
+		for _, key := range d.Keys {
+			if t.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LabelDetector matches nodes whose labels match the selector.
+type LabelDetector struct {
+	Selector labels.Selector
+}
+
+func NewLabelDetector(selector string) (LabelDetector, error) {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return LabelDetector{}, err
+	}
+	return LabelDetector{Selector: s}, nil
+}
+
+func (d LabelDetector) IsControlPlane(node *v1.Node) bool {
+	return d.Selector.Matches(labels.Set(node.Labels))
+}
+
+// NameDetector matches nodes whose name matches the pattern.
+type NameDetector struct {
+	Pattern *regexp.Regexp
+}
+
+func NewNameDetector(pattern string) (NameDetector, error) {
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return NameDetector{}, err
+	}
+	return NameDetector{Pattern: r}, nil
+}
+
+func (d NameDetector) IsControlPlane(node *v1.Node) bool {
+	return d.Pattern.MatchString(node.Name)
+}
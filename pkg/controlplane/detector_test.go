@@ -0,0 +1,128 @@
+package controlplane
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var TaintedNode = &v1.Node{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "test-tainted-node",
+	},
+	Spec: v1.NodeSpec{
+		Taints: []v1.Taint{
+			{
+				Key:    "node-role.kubernetes.io/master",
+				Effect: "NoSchedule",
+			},
+		},
+	},
+}
+var LabeledNode = &v1.Node{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "test-labeled-node",
+		Labels: map[string]string{
+			"node-role.kubernetes.io/control-plane": "true",
+		},
+	},
+}
+var KindControlPlaneNode = &v1.Node{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "kind-control-plane",
+	},
+}
+var WorkerNode = &v1.Node{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "kind-worker",
+	},
+}
+
+func TestTaintDetector(t *testing.T) {
+	d := NewTaintDetector("node-role.kubernetes.io/control-plane", "node-role.kubernetes.io/master")
+	if !d.IsControlPlane(TaintedNode) {
+		t.Errorf("Expected node %s to be detected by taint", TaintedNode.Name)
+	}
+	if d.IsControlPlane(WorkerNode) {
+		t.Errorf("Expected node %s not to be detected by taint", WorkerNode.Name)
+	}
+}
+
+func TestLabelDetector(t *testing.T) {
+	d, err := NewLabelDetector("node-role.kubernetes.io/control-plane")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !d.IsControlPlane(LabeledNode) {
+		t.Errorf("Expected node %s to be detected by label", LabeledNode.Name)
+	}
+	if d.IsControlPlane(WorkerNode) {
+		t.Errorf("Expected node %s not to be detected by label", WorkerNode.Name)
+	}
+
+	if _, err := NewLabelDetector("a in (b"); err == nil {
+		t.Errorf("Expected error for invalid selector")
+	}
+}
+
+func TestNameDetector(t *testing.T) {
+	d, err := NewNameDetector("-control-plane(-[0-9]+)?$")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !d.IsControlPlane(KindControlPlaneNode) {
+		t.Errorf("Expected node %s to be detected by name", KindControlPlaneNode.Name)
+	}
+	if d.IsControlPlane(WorkerNode) {
+		t.Errorf("Expected node %s not to be detected by name", WorkerNode.Name)
+	}
+}
+
+func TestMirrorPodDetector(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "kube-apiserver-kind-control-plane",
+				Namespace:   APIServerPodNamespace,
+				Labels:      map[string]string{"component": "kube-apiserver"},
+				Annotations: map[string]string{MirrorPodAnnotation: "abc"},
+			},
+			Spec: v1.PodSpec{NodeName: KindControlPlaneNode.Name},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "kube-apiserver-proxy",
+				Namespace: APIServerPodNamespace,
+				Labels:    map[string]string{"component": "kube-apiserver"},
+			},
+			Spec: v1.PodSpec{NodeName: WorkerNode.Name},
+		},
+	)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	d := NewMirrorPodDetector(clientset)
+	d.Run(stopCh)
+
+	if !d.IsControlPlane(KindControlPlaneNode) {
+		t.Errorf("Expected node %s to be detected by mirror pod", KindControlPlaneNode.Name)
+	}
+	if d.IsControlPlane(WorkerNode) {
+		t.Errorf("Expected node %s not to be detected, pod isn't a mirror pod", WorkerNode.Name)
+	}
+}
+
+func TestAny(t *testing.T) {
+	name, _ := NewNameDetector("-control-plane$")
+	d := Any{NewTaintDetector("node-role.kubernetes.io/master"), name}
+	for _, node := range []*v1.Node{TaintedNode, KindControlPlaneNode} {
+		if !d.IsControlPlane(node) {
+			t.Errorf("Expected node %s to be detected", node.Name)
+		}
+	}
+	if d.IsControlPlane(WorkerNode) {
+		t.Errorf("Expected node %s not to be detected", WorkerNode.Name)
+	}
+}
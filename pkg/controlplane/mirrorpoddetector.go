@@ -0,0 +1,105 @@
+package controlplane
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	MirrorPodAnnotation     = "kubernetes.io/config.mirror"
+	APIServerPodSelector    = "component=kube-apiserver"
+	APIServerPodNamespace   = metav1.NamespaceSystem
+	mirrorPodNodeNameIndex  = "nodeName"
+	mirrorPodResyncInterval = 10 * time.Minute
+)
+
+// MirrorPodDetector matches nodes running a kube-apiserver static pod,
+// recognized by its mirror pod in kube-system bound to the node.
+type MirrorPodDetector struct {
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+}
+
+func NewMirrorPodDetector(client kubernetes.Interface) MirrorPodDetector {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, mirrorPodResyncInterval,
+		informers.WithNamespace(APIServerPodNamespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = APIServerPodSelector
+		}),
+	)
+	informer := factory.Core().V1().Pods().Informer()
+	err := informer.AddIndexers(cache.Indexers{
+		mirrorPodNodeNameIndex: func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*v1.Pod)
+			if !ok || pod.Spec.NodeName == "" {
+				return nil, nil
+			}
+			return []string{pod.Spec.NodeName}, nil
+		},
+	})
+	if err != nil {
+		log.Errorf("Failed to add node name index to mirror pod informer: %v", err)
+	}
+
+	return MirrorPodDetector{
+		factory:  factory,
+		informer: informer,
+	}
+}
+
+// Run starts watching kube-apiserver pods and blocks until the cache is synced.
+func (d MirrorPodDetector) Run(stopCh <-chan struct{}) {
+	d.factory.Start(stopCh)
+	d.factory.WaitForCacheSync(stopCh)
+}
+
+// OnNodeChange calls f with the node name of every kube-apiserver mirror pod
+// that's added or changes. The kubelet creates the mirror pod only after the
+// node registered, so the node has to be relabeled then. Resyncs are skipped.
+func (d MirrorPodDetector) OnNodeChange(f func(nodeName string)) {
+	notify := func(obj interface{}) {
+		pod, ok := obj.(*v1.Pod)
+		if !ok || pod.Spec.NodeName == "" {
+			return
+		}
+		if _, mirror := pod.Annotations[MirrorPodAnnotation]; mirror {
+			f(pod.Spec.NodeName)
+		}
+	}
+	_, err := d.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: notify,
+		UpdateFunc: func(old, new interface{}) {
+			oldPod, oldOk := old.(*v1.Pod)
+			newPod, newOk := new.(*v1.Pod)
+			if oldOk && newOk && oldPod.ResourceVersion == newPod.ResourceVersion {
+				return
+			}
+			notify(new)
+		},
+	})
+	if err != nil {
+		log.Errorf("Failed to add event handler to mirror pod informer: %v", err)
+	}
+}
+
+func (d MirrorPodDetector) IsControlPlane(node *v1.Node) bool {
+	pods, err := d.informer.GetIndexer().ByIndex(mirrorPodNodeNameIndex, node.Name)
+	if err != nil {
+		log.WithField("node", node.Name).Errorf("Failed to look up kube-apiserver pods: %v", err)
+		return false
+	}
+	for _, obj := range pods {
+		if pod, ok := obj.(*v1.Pod); ok {
+			if _, mirror := pod.Annotations[MirrorPodAnnotation]; mirror {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package karpenter
+
+import (
+	"time"
+
+	"github.com/daspawnw/k8s-node-label/pkg/common"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+)
+
+// nodeClaimResyncInterval is the resync interval of the NodeClaim informer.
+const nodeClaimResyncInterval = 10 * time.Minute
+
+// NodeClaimResource is the cluster scoped resource Karpenter launches nodes from.
+var NodeClaimResource = schema.GroupVersionResource{Group: "karpenter.sh", Version: "v1", Resource: "nodeclaims"}
+
+// NodeClaimLookup finds the NodeClaim of a node by its name or provider ID.
+// Karpenter copies the NodeClaim labels to the node only once it registered,
+// so they're available a bit earlier on the NodeClaim.
+type NodeClaimLookup struct {
+	nodeClaims common.NodeObjectLookup
+}
+
+func NewNodeClaimLookup(client dynamic.Interface) NodeClaimLookup {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, nodeClaimResyncInterval)
+	return NodeClaimLookup{
+		nodeClaims: common.NewNodeObjectLookup(factory, NodeClaimResource,
+			[]string{"status", "nodeName"}, []string{"status", "providerID"}),
+	}
+}
+
+// Run starts watching NodeClaims and blocks until the cache is synced.
+func (l NodeClaimLookup) Run(stopCh <-chan struct{}) {
+	l.nodeClaims.Run(stopCh)
+}
+
+// NodeClaimLabels returns the labels of the NodeClaim the node was launched
+// from, or nil if there is none.
+func (l NodeClaimLookup) NodeClaimLabels(node *v1.Node) map[string]string {
+	if claim := l.nodeClaims.Object(node); claim != nil {
+		return claim.GetLabels()
+	}
+	return nil
+}
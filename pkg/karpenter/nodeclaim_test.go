@@ -0,0 +1,70 @@
+package karpenter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func nodeClaim(name string, nodeName string, providerID string, labels map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "karpenter.sh/v1",
+		"kind":       "NodeClaim",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": labels,
+		},
+		"status": map[string]interface{}{
+			"nodeName":   nodeName,
+			"providerID": providerID,
+		},
+	}}
+}
+
+func TestNodeClaimLookup(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{NodeClaimResource: "NodeClaimList"},
+		nodeClaim("default-abcde", "registered", "aws:///eu-central-1a/i-1", map[string]interface{}{"karpenter.sh/nodepool": "default"}),
+		nodeClaim("gpu-fghij", "", "aws:///eu-central-1a/i-2", map[string]interface{}{"karpenter.sh/nodepool": "gpu"}),
+	)
+	lookup := NewNodeClaimLookup(client)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	lookup.Run(stopCh)
+
+	testCases := []struct {
+		name     string
+		node     *v1.Node
+		expected map[string]string
+	}{
+		{
+			name:     "by node name",
+			node:     &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "registered"}},
+			expected: map[string]string{"karpenter.sh/nodepool": "default"},
+		},
+		{
+			name: "by provider id",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "launching"},
+				Spec:       v1.NodeSpec{ProviderID: "aws:///eu-central-1a/i-2"},
+			},
+			expected: map[string]string{"karpenter.sh/nodepool": "gpu"},
+		},
+		{
+			name: "without nodeclaim",
+			node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, lookup.NodeClaimLabels(tc.node))
+		})
+	}
+}
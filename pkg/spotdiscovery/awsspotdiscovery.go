@@ -1,6 +1,7 @@
 package spotdiscovery
 
 import (
+	"fmt"
 	"regexp"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -14,7 +15,8 @@ type EC2SpotDiscovery struct {
 	ec2Client ec2iface.EC2API
 }
 
-func (d EC2SpotDiscovery) IsSpotInstance(node *v1.Node) bool {
+func (d EC2SpotDiscovery) IsSpotInstance(logger log.FieldLogger, node *v1.Node) (bool, error) {
+	logger = logger.WithField("provider", "aws")
 	instanceID := receiveInstanceID(node)
 	if instanceID != nil {
 		input := ec2.DescribeSpotInstanceRequestsInput{
@@ -27,13 +29,23 @@ func (d EC2SpotDiscovery) IsSpotInstance(node *v1.Node) bool {
 		}
 		spotRequest, err := d.ec2Client.DescribeSpotInstanceRequests(&input)
 		if err != nil {
-			log.Errorf("Failed to detect if node %s spot instance request in ec2 with error: %v", node.Name, err)
-			return false
+			return false, fmt.Errorf("failed to detect spot instance request in ec2: %w", err)
 		}
 
-		return len(spotRequest.SpotInstanceRequests) == 1
+		isSpot := len(spotRequest.SpotInstanceRequests) == 1
+		logger.WithField("instance_id", *instanceID).Debugf("Spot instance lookup: %t", isSpot)
+		return isSpot, nil
 	}
-	return false
+	logger.Debugf("Skip spot instance lookup, no instance id in provider id %q", node.Spec.ProviderID)
+	return false, nil
+}
+
+// InstanceID returns the EC2 instance id from the provider ID of node.
+func InstanceID(node *v1.Node) (string, bool) {
+	if instanceID := receiveInstanceID(node); instanceID != nil {
+		return *instanceID, true
+	}
+	return "", false
 }
 
 func receiveInstanceID(node *v1.Node) *string {
@@ -1,10 +1,13 @@
 package spotdiscovery
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -37,7 +40,10 @@ func TestIsSpotShouldReturnFalseForNonSpotInstance(t *testing.T) {
 		ec2Client: &MockEC2Client{},
 	}
 
-	response := spot.IsSpotInstance(WorkerNode)
+	response, err := spot.IsSpotInstance(log.StandardLogger(), WorkerNode)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
 	if response == true {
 		t.Errorf("Expected no spot response for test-worker-node, but has spot response")
 	}
@@ -48,7 +54,10 @@ func TestIsSpotShouldReturnTrueForSpotInstance(t *testing.T) {
 		ec2Client: &MockEC2Client{},
 	}
 
-	response := spot.IsSpotInstance(SpotWorkerNode)
+	response, err := spot.IsSpotInstance(log.StandardLogger(), SpotWorkerNode)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
 	if response == false {
 		t.Errorf("Expected spot response for test-spot-node, but no response available")
 	}
@@ -59,17 +68,50 @@ func TestIsSpotShouldReturnFalseForNonProviderManagedInstance(t *testing.T) {
 		ec2Client: &MockEC2Client{},
 	}
 
-	response := spot.IsSpotInstance(UnManagedNode)
+	response, err := spot.IsSpotInstance(log.StandardLogger(), UnManagedNode)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
 	if response == true {
 		t.Errorf("Expected no spot response for test-worker-node, but has spot response")
 	}
 }
 
+func TestIsSpotShouldLogWithFieldsOfNodeEvent(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(log.DebugLevel)
+	spot := EC2SpotDiscovery{
+		ec2Client: &MockEC2Client{},
+	}
+
+	_, _ = spot.IsSpotInstance(logger.WithField("reconcile_id", "abc"), SpotWorkerNode)
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Data["reconcile_id"] != "abc" || entry.Data["provider"] != "aws" {
+		t.Errorf("Expected spot lookup to be logged with reconcile_id and provider, got %v", entry)
+	}
+}
+
+func TestIsSpotShouldReturnErrorIfLookupFails(t *testing.T) {
+	spot := EC2SpotDiscovery{
+		ec2Client: &MockEC2Client{err: errors.New("throttled")},
+	}
+
+	_, err := spot.IsSpotInstance(log.StandardLogger(), SpotWorkerNode)
+	if err == nil {
+		t.Errorf("Expected error for failed spot lookup, got none")
+	}
+}
+
 type MockEC2Client struct {
 	ec2iface.EC2API
+	err error
 }
 
 func (c *MockEC2Client) DescribeSpotInstanceRequests(in *ec2.DescribeSpotInstanceRequestsInput) (*ec2.DescribeSpotInstanceRequestsOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
 	spotInstances := []*ec2.SpotInstanceRequest{}
 	if len(in.Filters) == 1 && len(in.Filters[0].Values) == 1 {
 		instanceID := in.Filters[0].Values[0]
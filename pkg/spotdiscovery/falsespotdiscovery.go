@@ -1,9 +1,12 @@
 package spotdiscovery
 
-import v1 "k8s.io/api/core/v1"
+import (
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+)
 
 type FalseSpotDiscovery struct{}
 
-func (FalseSpotDiscovery) IsSpotInstance(node *v1.Node) bool {
-	return false
+func (FalseSpotDiscovery) IsSpotInstance(logger log.FieldLogger, node *v1.Node) (bool, error) {
+	return false, nil
 }
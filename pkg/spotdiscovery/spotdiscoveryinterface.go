@@ -1,7 +1,13 @@
 package spotdiscovery
 
-import v1 "k8s.io/api/core/v1"
+import (
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+)
 
 type SpotDiscoveryInterface interface {
-	IsSpotInstance(node *v1.Node) bool
-}
\ No newline at end of file
+	// IsSpotInstance reports whether node runs on a spot instance. logger
+	// carries the fields of the node event, e.g. its reconcile_id. An error
+	// means the provider can't tell yet, e.g. because its API failed.
+	IsSpotInstance(logger log.FieldLogger, node *v1.Node) (bool, error)
+}